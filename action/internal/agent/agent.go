@@ -2,136 +2,592 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"slices"
 	"strings"
+	"sync"
 
+	"github.com/AkshayNayak/ticketflow/action/internal/files"
 	"github.com/AkshayNayak/ticketflow/action/internal/provider"
 )
 
 // Config holds the configuration for the agent.
 type Config struct {
-	Provider          string // "claude", "openai", "gemini"
+	Provider          string // see provider.NewProvider for supported names
 	APIKey            string
 	Model             string
+	BaseURL           string
+	Headers           map[string]string
+	Project           string // Vertex AI project
+	Location          string // Vertex AI region
+	CredentialsJSON   string // Vertex AI service-account key; empty uses Application Default Credentials
+	APIVersion        string // Azure OpenAI api-version
 	TicketKey         string
 	TicketTitle       string
 	TicketDescription string
 	Workspace         string
+	Images            []string // ticket screenshots or mockups, relative to the workspace
 	MaxTurns          int
+	MaxTokens         int                      // output tokens per turn (0 = model default); raised up to the model's limit on truncation
+	MaxRetries        int                      // retries per provider request on transient errors (0 = none, negative = provider.DefaultMaxRetries)
+	RateLimit         provider.RateLimitConfig // client-side requests and tokens per minute
+	RateLimiter       *provider.RateLimiter    // shared with other agents in the process; overrides RateLimit
+	BudgetUSD         float64                  // stop once the run has cost this much (0 = unlimited)
+	BudgetTokens      int                      // stop once the run has used this many tokens (0 = unlimited)
+	Pricing           provider.PriceTable      // overrides for provider.DefaultPrices
+	Models            provider.ModelTable      // overrides for provider.DefaultModels
+	CompactAt         float64                  // share of the usable context window that triggers compaction (0 = provider.DefaultCompactionFraction, negative disables)
+	RecordPath        string                   // if set, record every provider exchange to this cassette file
+	Reasoning         provider.Reasoning       // extended thinking budget / reasoning effort
+	Fallbacks         []provider.Config        // providers to try, in order, if the primary fails
+}
+
+// Status describes how an agent run ended.
+type Status string
+
+const (
+	StatusCompleted       Status = "completed"
+	StatusMaxTurns        Status = "max_turns_reached"
+	StatusBudgetExhausted Status = "budget_exhausted"
+	StatusContentFiltered Status = "content_filtered" // a response or request was blocked by a content filter
+	StatusRefused         Status = "refused"          // the model declined the task
+
+	// Statuses for runs that ended because every provider failed.
+	StatusRateLimited     Status = "rate_limited"
+	StatusQuotaExceeded   Status = "quota_exceeded" // the account is out of credit
+	StatusAuthFailed      Status = "auth_failed"
+	StatusContextOverflow Status = "context_overflow"
+	StatusServerError     Status = "server_error" // the provider failed or was overloaded
+	StatusProviderError   Status = "provider_error"
+)
+
+// errorStatus maps a provider error to the status reported for the run.
+func errorStatus(err error) Status {
+	switch {
+	case errors.Is(err, provider.ErrRateLimited):
+		return StatusRateLimited
+	case errors.Is(err, provider.ErrQuotaExceeded):
+		return StatusQuotaExceeded
+	case errors.Is(err, provider.ErrAuth):
+		return StatusAuthFailed
+	case errors.Is(err, provider.ErrContextOverflow):
+		return StatusContextOverflow
+	case errors.Is(err, provider.ErrContentFiltered):
+		return StatusContentFiltered
+	case errors.Is(err, provider.ErrServer):
+		return StatusServerError
+	default:
+		return StatusProviderError
+	}
 }
 
 // Result holds the outcome of an agent run.
 type Result struct {
+	Status       Status
 	Summary      string
 	FilesChanged []string
+	Usage        provider.Usage // total tokens across all turns
+	CostUSD      float64        // estimated cost, 0 if the model is not priced
+	Providers    []string       // "provider/model" of each provider used, in order
 }
 
 // Agent orchestrates the AI-powered implementation loop.
 type Agent struct {
-	config   Config
+	config  Config
+	chain   []chainEntry // primary provider followed by fallbacks
+	active  int          // index into chain of the provider in use
+	tracker *ChangeTracker
+}
+
+// chainEntry is one provider in the fallback chain.
+type chainEntry struct {
+	name     string
+	model    string
+	info     provider.ModelInfo
 	provider provider.Provider
-	tracker  *ChangeTracker
+}
+
+func newChainEntry(name, model string, p provider.Provider, models provider.ModelTable) chainEntry {
+	if model == "" {
+		model = provider.DefaultModel(name)
+	}
+	info, ok := provider.LookupModel(models, model)
+	if !ok {
+		log.Printf("Warning: model %q is not in the model registry; assuming a %d-token context window", model, info.ContextWindow)
+	}
+	return chainEntry{name: name, model: model, info: info, provider: p}
+}
+
+func (e chainEntry) String() string {
+	return e.name + "/" + e.model
 }
 
 // New creates a new Agent with the given configuration.
 func New(cfg Config) (*Agent, error) {
-	if cfg.MaxTurns == 0 {
-		cfg.MaxTurns = 50
-	}
 	if cfg.Provider == "" {
 		cfg.Provider = "claude"
 	}
 
-	p, err := provider.NewProvider(cfg.Provider, cfg.APIKey, cfg.Model)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create provider: %w", err)
+	configs := append([]provider.Config{{
+		Name:    cfg.Provider,
+		APIKey:  cfg.APIKey,
+		Model:   cfg.Model,
+		BaseURL: cfg.BaseURL,
+		Headers: cfg.Headers,
+
+		Project:         cfg.Project,
+		Location:        cfg.Location,
+		CredentialsJSON: cfg.CredentialsJSON,
+		APIVersion:      cfg.APIVersion,
+	}}, cfg.Fallbacks...)
+
+	limiter := cfg.RateLimiter
+	if limiter == nil && (cfg.RateLimit.RequestsPerMinute > 0 || cfg.RateLimit.TokensPerMinute > 0) {
+		limiter = provider.NewRateLimiter(cfg.RateLimit)
+	}
+
+	var recorder *provider.Recorder
+	if cfg.RecordPath != "" {
+		recorder = provider.NewCassetteRecorder(cfg.RecordPath)
+	}
+
+	chain := make([]chainEntry, 0, len(configs))
+	for _, pc := range configs {
+		p, err := provider.NewProvider(pc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create provider: %w", err)
+		}
+		if limiter != nil {
+			p = limiter.Wrap(p)
+		}
+		p = provider.WithRetry(p, provider.RetryConfig{MaxRetries: cfg.MaxRetries})
+		if recorder != nil {
+			p = recorder.Wrap(p)
+		}
+		chain = append(chain, newChainEntry(pc.Name, pc.Model, p, cfg.Models))
+	}
+
+	return newAgent(cfg, chain), nil
+}
+
+// NewWithProvider creates an Agent that talks to the given provider instead
+// of constructing one from the config, e.g. a replay provider in tests.
+func NewWithProvider(cfg Config, p provider.Provider) *Agent {
+	return newAgent(cfg, []chainEntry{newChainEntry(cfg.Provider, cfg.Model, p, cfg.Models)})
+}
+
+func newAgent(cfg Config, chain []chainEntry) *Agent {
+	if cfg.MaxTurns == 0 {
+		cfg.MaxTurns = 50
 	}
 
 	return &Agent{
-		config:   cfg,
-		provider: p,
-		tracker:  NewChangeTracker(),
-	}, nil
+		config:  cfg,
+		chain:   chain,
+		tracker: NewChangeTracker(),
+	}
 }
 
 // Run executes the agent loop: sends messages to the LLM, handles tool calls,
 // and repeats until the model stops requesting tools or max turns is reached.
+// If the providers fail, Run returns the error together with a Result
+// describing the work done so far, with a Status naming the kind of failure.
 func (a *Agent) Run(ctx context.Context) (*Result, error) {
 	systemPrompt := BuildSystemPrompt(a.config.TicketKey, a.config.TicketTitle, a.config.TicketDescription)
 
+	for _, entry := range a.chain {
+		if a.config.Reasoning.Enabled() && !entry.info.Reasoning {
+			log.Printf("Warning: %s does not support reasoning; reasoning settings are ignored for it", entry)
+		}
+	}
+
 	repoTree := buildRepoTree(a.config.Workspace)
-	initialMessage := BuildInitialUserMessage(repoTree)
+	images, imageNames := a.loadImages()
+	initialMessage := BuildInitialUserMessage(repoTree, imageNames)
 
 	messages := []provider.Message{
-		provider.UserMessage(provider.NewTextBlock(initialMessage)),
+		provider.UserMessage(append([]provider.ContentBlock{provider.NewTextBlock(initialMessage)}, images...)...),
 	}
 	tools := ToolDefinitions()
+	compactor := newCompactor(messages[0])
 
 	var summaryParts []string
+	var usage provider.Usage
+	spend := newBudget(a.config)
+	status := StatusMaxTurns
+	providersUsed := []string{a.chain[a.active].String()}
+	var runErr error
+	maxTokens := a.config.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = a.chain[a.active].info.MaxTokens
+	}
+	addUsage := func(u provider.Usage) {
+		if u == (provider.Usage{}) {
+			return
+		}
+		usage.Add(u)
+		spend.add(a.chain[a.active].name, a.chain[a.active].model, u)
+	}
 
 	for turn := 0; turn < a.config.MaxTurns; turn++ {
-		log.Printf("[turn %d] Sending request to %s (%s)...", turn+1, a.config.Provider, a.config.Model)
-
-		response, err := a.provider.Chat(ctx, provider.ChatParams{
+		request := provider.ChatParams{
 			System:    systemPrompt,
 			Messages:  messages,
 			Tools:     tools,
-			MaxTokens: 8192,
-		})
+			MaxTokens: maxTokens,
+			Reasoning: a.config.Reasoning,
+		}
+		// Spend the last turn on a summary rather than a tool call whose
+		// result the model would never see.
+		finalTurn := a.config.MaxTurns > 1 && turn == a.config.MaxTurns-1
+		if finalTurn {
+			request.ToolChoice = provider.ToolChoice{Mode: provider.ToolChoiceNone}
+		}
+
+		params, spent, err := a.fitContext(ctx, turn+1, compactor, request)
+		addUsage(spent)
 		if err != nil {
-			return nil, fmt.Errorf("API error on turn %d: %w", turn+1, err)
+			status = errorStatus(err)
+			runErr = fmt.Errorf("turn %d: %w", turn+1, err)
+			break
+		}
+		messages = params.Messages
+
+		response, err := a.chat(ctx, turn+1, params)
+		for err != nil && ctx.Err() == nil && a.active+1 < len(a.chain) {
+			failed := a.chain[a.active]
+			a.active++
+			log.Printf("[turn %d] %s failed: %v — falling back to %s", turn+1, failed, err, a.chain[a.active])
+			providersUsed = append(providersUsed, a.chain[a.active].String())
+
+			// The new model may have a smaller context window or output
+			// limit, so the request is fitted to it afresh.
+			request.Messages = portableMessages(messages)
+			params, spent, err = a.fitContext(ctx, turn+1, compactor, request)
+			addUsage(spent)
+			if err != nil {
+				break
+			}
+			messages = params.Messages
+			response, err = a.chat(ctx, turn+1, params)
+		}
+		if err != nil {
+			status = errorStatus(err)
+			runErr = fmt.Errorf("API error on turn %d: %w", turn+1, err)
+			break
 		}
 
 		log.Printf("[turn %d] Stop reason: %s, content blocks: %d", turn+1, response.StopReason, len(response.Content))
+		addUsage(response.Usage)
+		log.Printf("[turn %d] Tokens: %s", turn+1, response.Usage)
 
 		// Process response content blocks
 		var assistantBlocks []provider.ContentBlock
-		var toolResultBlocks []provider.ContentBlock
+		var toolCalls []provider.ContentBlock
+		var discarded []string
+		truncated := response.StopReason == provider.StopReasonMaxTokens
 
 		for _, block := range response.Content {
+			// A tool call cut off by the output limit carries partial JSON;
+			// executing it could write half a file, so drop it instead.
+			if truncated && block.Type == "tool_use" && !json.Valid(block.ToolInput) {
+				log.Printf("[turn %d] Discarding truncated %s call", turn+1, block.ToolName)
+				discarded = append(discarded, block.ToolName)
+				continue
+			}
 			assistantBlocks = append(assistantBlocks, block)
 
 			switch block.Type {
 			case "text":
-				log.Printf("[turn %d] Text: %s", turn+1, truncate(block.Text, 200))
 				summaryParts = append(summaryParts, block.Text)
 
 			case "tool_use":
-				log.Printf("[turn %d] Tool call: %s", turn+1, block.ToolName)
-
-				result, isError := HandleToolCall(a.config.Workspace, block.ToolName, block.ToolInput, a.tracker)
-				log.Printf("[turn %d] Tool result (%s): %s", turn+1, block.ToolName, truncate(result, 200))
-
-				toolResultBlocks = append(toolResultBlocks, provider.NewToolResultBlock(block.ToolUseID, result, isError))
+				toolCalls = append(toolCalls, block)
 			}
 		}
+		toolResultBlocks := a.runTools(turn+1, toolCalls)
+
+		if truncated {
+			if limit := a.chain[a.active].info.MaxOutputTokens; maxTokens < limit {
+				maxTokens = min(maxTokens*2, limit)
+				log.Printf("[turn %d] Output truncated, raising max tokens to %d", turn+1, maxTokens)
+			} else {
+				log.Printf("[turn %d] Output truncated at %d tokens", turn+1, maxTokens)
+			}
+			if len(assistantBlocks) == 0 {
+				assistantBlocks = append(assistantBlocks, provider.NewTextBlock("(response truncated)"))
+			}
+			toolResultBlocks = append(toolResultBlocks, provider.NewTextBlock(BuildContinuationMessage(discarded)))
+		}
 
 		// Add assistant response to conversation
 		messages = append(messages, provider.AssistantMessage(assistantBlocks...))
 
-		// If there were tool calls, send results back as a user message
+		// If there were tool calls or the output was cut off, send results
+		// and any continuation request back as a user message
 		if len(toolResultBlocks) > 0 {
+			if note := spend.warning(); note != "" {
+				log.Printf("[turn %d] Budget warning: %.0f%% used", turn+1, spend.used()*100)
+				toolResultBlocks = append(toolResultBlocks, provider.NewTextBlock(note))
+			}
+			if turn+1 == a.config.MaxTurns-1 {
+				toolResultBlocks = append(toolResultBlocks, provider.NewTextBlock(BuildFinalTurnMessage()))
+			}
 			messages = append(messages, provider.UserMessage(toolResultBlocks...))
 		}
 
-		// Stop if the model is done (no more tool calls)
-		if response.StopReason == provider.StopReasonEndTurn {
+		switch response.StopReason {
+		case provider.StopReasonContentFiltered:
+			log.Printf("[turn %d] Response was blocked by the provider's content filter", turn+1)
+			status = StatusContentFiltered
+		case provider.StopReasonRefusal:
+			log.Printf("[turn %d] Model declined to continue", turn+1)
+			status = StatusRefused
+		}
+		if finalTurn || status != StatusMaxTurns {
+			break
+		}
+
+		// Stop if the model is done (no more tool calls). A paused turn is
+		// not done: the conversation now ends with the paused assistant
+		// turn, and sending it back as-is lets the model resume.
+		paused := response.StopReason == provider.StopReasonPauseTurn
+		if !paused && (response.StopReason == provider.StopReasonEndTurn || len(toolResultBlocks) == 0) {
 			log.Printf("Agent completed after %d turns", turn+1)
+			status = StatusCompleted
+			break
+		}
+
+		if spend.exhausted() {
+			log.Printf("Budget exhausted after %d turns (%s, $%.4f)", turn+1, usage, spend.cost())
+			status = StatusBudgetExhausted
 			break
 		}
 	}
 
+	if status == StatusMaxTurns {
+		log.Printf("Agent stopped after reaching the limit of %d turns", a.config.MaxTurns)
+	}
+
 	summary := strings.Join(summaryParts, "\n")
-	if summary == "" {
+	if summary == "" && runErr != nil {
+		summary = fmt.Sprintf("Agent stopped early: %v", runErr)
+	} else if summary == "" {
 		summary = "Agent completed implementation."
 	}
 
 	return &Result{
+		Status:       status,
 		Summary:      summary,
 		FilesChanged: a.tracker.Files(),
-	}, nil
+		Usage:        usage,
+		CostUSD:      spend.cost(),
+		Providers:    providersUsed,
+	}, runErr
+}
+
+// loadImages reads the configured ticket images as image blocks. Images that
+// cannot be read are skipped with a warning rather than failing the run.
+func (a *Agent) loadImages() ([]provider.ContentBlock, []string) {
+	if len(a.config.Images) > 0 && !a.chain[a.active].info.Images {
+		log.Printf("Warning: %s does not accept images; skipping %d ticket image(s)", a.chain[a.active], len(a.config.Images))
+		return nil, nil
+	}
+
+	var blocks []provider.ContentBlock
+	var names []string
+	for _, path := range a.config.Images {
+		data, mediaType, err := files.ReadImage(a.config.Workspace, path)
+		if err != nil {
+			log.Printf("Warning: skipping image: %v", err)
+			continue
+		}
+		log.Printf("Attaching image %s (%s, %d bytes)", path, mediaType, len(data))
+		blocks = append(blocks, provider.NewImageBlock(data, mediaType))
+		names = append(names, path)
+	}
+	return blocks, names
+}
+
+// maxParallelTools caps how many read-only tool calls run at once.
+const maxParallelTools = 8
+
+// runTools executes a turn's tool calls and returns their results in call
+// order. Consecutive read-only calls run concurrently, up to
+// maxParallelTools at a time; every other call runs on its own, so writes
+// stay serialized and later reads see them.
+func (a *Agent) runTools(turn int, calls []provider.ContentBlock) []provider.ContentBlock {
+	results := make([]provider.ContentBlock, len(calls))
+	for start := 0; start < len(calls); {
+		end := start + 1
+		if readOnlyTools[calls[start].ToolName] {
+			for end < len(calls) && readOnlyTools[calls[end].ToolName] {
+				end++
+			}
+		}
+		batch := calls[start:end]
+		for _, call := range batch {
+			log.Printf("[turn %d] Tool call: %s", turn, call.ToolName)
+		}
+		if len(batch) > 1 {
+			log.Printf("[turn %d] Running %d read-only tool calls concurrently", turn, len(batch))
+		}
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, maxParallelTools)
+		for i, call := range batch {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				result, isError := HandleToolCall(a.config.Workspace, call.ToolName, call.ToolInput, a.tracker)
+				results[start+i] = provider.NewToolResultBlock(call.ToolUseID, result, isError)
+			}()
+		}
+		wg.Wait()
+
+		for i, call := range batch {
+			log.Printf("[turn %d] Tool result (%s): %s", turn, call.ToolName, truncate(results[start+i].ToolResult, 200))
+		}
+		start = end
+	}
+	return results
+}
+
+// minOutputTokens is the smallest output allowance a request is sent with.
+const minOutputTokens = 1024
+
+// fitContext prepares a request for the active model. It measures the
+// prompt, compacts older turns once the prompt grows past the compaction
+// threshold, and shrinks the output allowance if the two would still not fit
+// the context window. It returns the request to send and the usage of any
+// summarization request.
+//
+// Compaction runs at most once per turn and model, so only a fallback to
+// another model summarizes again within a turn; a prompt still over the
+// threshold is sent as long as it fits and compacted again on a later turn. A prompt that leaves no room
+// for output fails with provider.ErrContextOverflow instead.
+func (a *Agent) fitContext(ctx context.Context, turn int, c *compactor, params provider.ChatParams) (provider.ChatParams, provider.Usage, error) {
+	info := a.chain[a.active].info
+	var spent provider.Usage
+
+	params.SerialTools = !info.ParallelTools
+
+	// A fallback may not accept the ticket images the first model was
+	// sent; the compactor's copy goes too, or a summary would restore them.
+	if !info.Images {
+		c.initial = withoutImages([]provider.Message{c.initial})[0]
+		params.Messages = withoutImages(params.Messages)
+	}
+
+	// Reasoning counts toward the output limit, so its budget goes on top
+	// of the answer allowance before the two are fitted together.
+	if info.Reasoning {
+		params.MaxTokens += params.Reasoning.Budget()
+	}
+
+	promptTokens := a.countTokens(ctx, turn, params)
+	threshold := info.CompactionThreshold(a.config.CompactAt, min(params.MaxTokens, info.MaxOutputTokens))
+	if a.config.CompactAt >= 0 && (c.compactedTurn != turn || c.compactedFor != a.active) && promptTokens > threshold {
+		log.Printf("[turn %d] Prompt of %d tokens is over the %d-token compaction threshold, compacting", turn, promptTokens, threshold)
+		c.compactedTurn, c.compactedFor = turn, a.active
+		var compacted []provider.Message
+		var tokens int
+		compacted, tokens, spent = a.compact(ctx, turn, c, params, promptTokens, threshold)
+		if compacted != nil {
+			log.Printf("[turn %d] Compaction reclaimed %d tokens (%d -> %d)", turn, promptTokens-tokens, promptTokens, tokens)
+			params.Messages = compacted
+			promptTokens = tokens
+		}
+	}
+
+	if promptTokens+minOutputTokens > info.ContextWindow {
+		return params, spent, fmt.Errorf("prompt of %d tokens leaves no room for output in the %d-token context window: %w", promptTokens, info.ContextWindow, provider.ErrContextOverflow)
+	}
+	if room := info.ContextWindow - promptTokens; params.MaxTokens > room {
+		params.MaxTokens = room
+		log.Printf("[turn %d] Limiting output to %d tokens to fit the context window", turn, params.MaxTokens)
+	}
+	return params, spent, nil
+}
+
+// countTokens measures the prompt with the active provider, falling back to
+// an offline estimate if counting fails.
+func (a *Agent) countTokens(ctx context.Context, turn int, params provider.ChatParams) int {
+	entry := a.chain[a.active]
+	n, err := entry.provider.CountTokens(ctx, params)
+	if err != nil {
+		n = provider.EstimateTokens(params)
+		log.Printf("[turn %d] Token count failed (%v), estimating %d tokens", turn, err, n)
+		return n
+	}
+	log.Printf("[turn %d] Prompt size: %d tokens (%.0f%% of %s context window)", turn, n, float64(n)*100/float64(entry.info.ContextWindow), entry)
+	return n
+}
+
+// chat sends one request to the active provider, logging streamed output.
+func (a *Agent) chat(ctx context.Context, turn int, params provider.ChatParams) (*provider.ChatResponse, error) {
+	entry := a.chain[a.active]
+	log.Printf("[turn %d] Sending request to %s...", turn, entry)
+
+	params.MaxTokens = min(params.MaxTokens, entry.info.MaxOutputTokens)
+	if !entry.info.Reasoning {
+		params.Reasoning = provider.Reasoning{}
+	}
+
+	stream := &streamLogger{turn: turn}
+	response, err := entry.provider.ChatStream(ctx, params, stream.handle)
+	stream.flush()
+	return response, err
+}
+
+// portableMessages prepares a conversation for a different provider by
+// dropping reasoning blocks and signatures, which are only meaningful to the
+// provider that produced them.
+func portableMessages(messages []provider.Message) []provider.Message {
+	out := make([]provider.Message, 0, len(messages))
+	for _, msg := range messages {
+		content := make([]provider.ContentBlock, 0, len(msg.Content))
+		for _, block := range msg.Content {
+			if block.Type == "thinking" || block.Type == "redacted_thinking" {
+				continue
+			}
+			block.Signature = ""
+			content = append(content, block)
+		}
+		if len(content) > 0 {
+			out = append(out, provider.Message{Role: msg.Role, Content: content})
+		}
+	}
+	return out
+}
+
+// withoutImages returns a copy of messages with each image block replaced
+// by a note, for models that do not accept images. The input messages are
+// not modified.
+func withoutImages(messages []provider.Message) []provider.Message {
+	out := slices.Clone(messages)
+	for i, msg := range messages {
+		var content []provider.ContentBlock
+		for j, block := range msg.Content {
+			if block.Type != "image" {
+				continue
+			}
+			if content == nil {
+				content = slices.Clone(msg.Content)
+			}
+			content[j] = provider.NewTextBlock("[Image omitted: this model does not accept images]")
+		}
+		if content != nil {
+			out[i].Content = content
+		}
+	}
+	return out
 }
 
 // buildRepoTree generates a directory tree of the workspace (up to 3 levels deep).
@@ -184,6 +640,58 @@ func buildTreeRecursive(dir, prefix string, b *strings.Builder, depth, maxDepth
 	}
 }
 
+// streamLogger logs streamed model text and reasoning line by line as it
+// arrives, so long turns show progress in the Actions log before the
+// response completes.
+type streamLogger struct {
+	turn    int
+	label   string // "Text" or "Thinking", the kind of output in pending
+	pending string
+}
+
+func (l *streamLogger) handle(event provider.StreamEvent) {
+	switch event.Type {
+	case provider.StreamEventTextDelta:
+		l.write("Text", event.Text)
+	case provider.StreamEventThinkingDelta:
+		l.write("Thinking", event.Text)
+	case provider.StreamEventToolUseStart:
+		l.flush()
+		log.Printf("[turn %d] Model is calling %s...", l.turn, event.ToolName)
+	}
+}
+
+func (l *streamLogger) write(label, delta string) {
+	if label != l.label {
+		l.flush()
+		l.label = label
+	}
+
+	text := l.pending + delta
+	for {
+		i := strings.IndexByte(text, '\n')
+		if i < 0 {
+			break
+		}
+		l.logLine(text[:i])
+		text = text[i+1:]
+	}
+	l.pending = text
+}
+
+// flush logs any buffered text that has not been terminated by a newline.
+func (l *streamLogger) flush() {
+	l.logLine(l.pending)
+	l.pending = ""
+}
+
+func (l *streamLogger) logLine(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	log.Printf("[turn %d] %s: %s", l.turn, l.label, line)
+}
+
 func truncate(s string, maxLen int) string {
 	if len(s) <= maxLen {
 		return s
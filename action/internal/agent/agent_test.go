@@ -0,0 +1,630 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AkshayNayak/ticketflow/action/internal/provider"
+	"github.com/AkshayNayak/ticketflow/action/internal/provider/fake"
+)
+
+func newTestAgent(t *testing.T, p provider.Provider, maxTurns int) (*Agent, string) {
+	t.Helper()
+	workspace := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workspace, "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return NewWithProvider(Config{
+		Provider:          "claude",
+		TicketKey:         "TEST-1",
+		TicketTitle:       "Test ticket",
+		TicketDescription: "Do the thing.",
+		Workspace:         workspace,
+		MaxTurns:          maxTurns,
+	}, p), workspace
+}
+
+// lastToolResult returns the tool result sent back for the given call ID.
+func lastToolResult(t testing.TB, params provider.ChatParams, id string) provider.ContentBlock {
+	t.Helper()
+	msg := params.Messages[len(params.Messages)-1]
+	for _, block := range msg.Content {
+		if block.Type == "tool_result" && block.ToolResultID == id {
+			return block
+		}
+	}
+	t.Fatalf("no tool result for %s in last message", id)
+	return provider.ContentBlock{}
+}
+
+func TestNewWarnsOnceForUnknownModel(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	if _, err := New(Config{Provider: "claude", Model: "claude-next", APIKey: "key"}); err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if n := strings.Count(logs.String(), "not in the model registry"); n != 1 {
+		t.Errorf("logged the registry warning %d times, want once:\n%s", n, logs.String())
+	}
+}
+
+func TestRunWritesFileAndCompletes(t *testing.T) {
+	p := fake.New(t,
+		fake.ToolCalls(fake.Call("call_1", "write_file", map[string]string{"path": "hello.txt", "content": "hi\n"})).
+			Expect(func(t testing.TB, params provider.ChatParams) {
+				if !strings.Contains(params.System, "TEST-1") {
+					t.Errorf("system prompt does not mention the ticket")
+				}
+				if len(params.Messages) != 1 || len(params.Tools) == 0 {
+					t.Errorf("first request: %d messages, %d tools", len(params.Messages), len(params.Tools))
+				}
+			}),
+		fake.Text("Added hello.txt.").
+			Expect(func(t testing.TB, params provider.ChatParams) {
+				if result := lastToolResult(t, params, "call_1"); result.IsError {
+					t.Errorf("write_file failed: %s", result.ToolResult)
+				}
+			}),
+	)
+	a, workspace := newTestAgent(t, p, 10)
+
+	result, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Status != StatusCompleted {
+		t.Errorf("status = %s, want %s", result.Status, StatusCompleted)
+	}
+	if got := strings.Join(result.FilesChanged, ","); got != "hello.txt" {
+		t.Errorf("files changed = %q, want hello.txt", got)
+	}
+	if data, err := os.ReadFile(filepath.Join(workspace, "hello.txt")); err != nil || string(data) != "hi\n" {
+		t.Errorf("hello.txt = %q, %v", data, err)
+	}
+	if !strings.Contains(result.Summary, "Added hello.txt.") {
+		t.Errorf("summary = %q", result.Summary)
+	}
+}
+
+func TestRunReportsToolErrorsToModel(t *testing.T) {
+	p := fake.New(t,
+		fake.ToolCalls(
+			fake.Call("call_1", "read_file", map[string]string{"path": "missing.go"}),
+			fake.Call("call_2", "read_file", map[string]string{"path": "../outside"}),
+			fake.Call("call_3", "no_such_tool", map[string]string{}),
+		),
+		fake.Text("Giving up.").
+			Expect(func(t testing.TB, params provider.ChatParams) {
+				for _, id := range []string{"call_1", "call_2", "call_3"} {
+					if !lastToolResult(t, params, id).IsError {
+						t.Errorf("%s: expected an error result", id)
+					}
+				}
+			}),
+	)
+	a, _ := newTestAgent(t, p, 10)
+
+	result, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Status != StatusCompleted || len(result.FilesChanged) != 0 {
+		t.Errorf("got status %s, files %v", result.Status, result.FilesChanged)
+	}
+}
+
+func TestRunEmptyResponse(t *testing.T) {
+	p := fake.New(t, fake.Respond(provider.StopReasonEndTurn))
+	a, _ := newTestAgent(t, p, 10)
+
+	result, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Status != StatusCompleted {
+		t.Errorf("status = %s, want %s", result.Status, StatusCompleted)
+	}
+	if result.Summary == "" {
+		t.Error("expected a default summary")
+	}
+}
+
+func TestRunStopsWhenNoToolsRequested(t *testing.T) {
+	// A tool_use stop without any tool calls leaves nothing to answer;
+	// the run must end rather than resend the same conversation.
+	p := fake.New(t, fake.Respond(provider.StopReasonToolUse, provider.NewTextBlock("Done.")))
+	a, _ := newTestAgent(t, p, 10)
+
+	result, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Status != StatusCompleted {
+		t.Errorf("status = %s, want %s", result.Status, StatusCompleted)
+	}
+}
+
+func TestRunMaxTurns(t *testing.T) {
+	list := fake.Call("call", "list_directory", map[string]string{"path": "."})
+	autoTools := func(t testing.TB, params provider.ChatParams) {
+		if params.ToolChoice.Mode != "" {
+			t.Errorf("tool choice = %q before the final turn", params.ToolChoice.Mode)
+		}
+	}
+	p := fake.New(t,
+		fake.ToolCalls(list).Expect(autoTools),
+		fake.ToolCalls(list).Expect(autoTools),
+		fake.Text("Listed the repository; nothing changed yet.").
+			Expect(func(t testing.TB, params provider.ChatParams) {
+				if params.ToolChoice.Mode != provider.ToolChoiceNone {
+					t.Errorf("final turn tool choice = %q, want none", params.ToolChoice.Mode)
+				}
+			}),
+	)
+	a, _ := newTestAgent(t, p, 3)
+
+	result, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Status != StatusMaxTurns {
+		t.Errorf("status = %s, want %s", result.Status, StatusMaxTurns)
+	}
+	if n := len(p.Calls()); n != 3 {
+		t.Errorf("provider called %d times, want 3", n)
+	}
+	if !strings.Contains(result.Summary, "nothing changed yet") {
+		t.Errorf("summary = %q, want the final-turn summary", result.Summary)
+	}
+}
+
+func TestRunProviderError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want Status
+	}{
+		{errors.New("boom"), StatusProviderError},
+		{&provider.APIError{Provider: "claude", Kind: provider.ErrRateLimited, Err: errors.New("slow down")}, StatusRateLimited},
+		{&provider.APIError{Provider: "openai", Kind: provider.ErrQuotaExceeded, Err: errors.New("out of credit")}, StatusQuotaExceeded},
+		{&provider.APIError{Provider: "openai", Kind: provider.ErrAuth, Err: errors.New("bad key")}, StatusAuthFailed},
+		{&provider.APIError{Provider: "claude", Kind: provider.ErrServer, Err: errors.New("overloaded")}, StatusServerError},
+		{&provider.APIError{Provider: "gemini", Kind: provider.ErrContextOverflow, Err: errors.New("too long")}, StatusContextOverflow},
+	}
+	for _, tt := range tests {
+		p := fake.New(t, fake.Fail(tt.err))
+		a, _ := newTestAgent(t, p, 10)
+
+		result, err := a.Run(context.Background())
+		if err == nil || !errors.Is(err, tt.err) {
+			t.Errorf("%v: Run error = %v, want it to wrap the provider error", tt.err, err)
+		}
+		if result == nil || result.Status != tt.want {
+			t.Errorf("%v: result = %+v, want status %s", tt.err, result, tt.want)
+		}
+	}
+}
+
+func TestRunBlockedResponses(t *testing.T) {
+	tests := []struct {
+		stop provider.StopReason
+		want Status
+	}{
+		{provider.StopReasonContentFiltered, StatusContentFiltered},
+		{provider.StopReasonRefusal, StatusRefused},
+	}
+	for _, tt := range tests {
+		// The tool call is still honored; the run just stops afterwards.
+		write := fake.Call("call_1", "write_file", map[string]string{"path": "a.txt", "content": "a"})
+		p := fake.New(t, fake.Respond(tt.stop, write))
+		a, _ := newTestAgent(t, p, 10)
+
+		result, err := a.Run(context.Background())
+		if err != nil {
+			t.Fatalf("%s: Run: %v", tt.stop, err)
+		}
+		if result.Status != tt.want {
+			t.Errorf("%s: status = %s, want %s", tt.stop, result.Status, tt.want)
+		}
+	}
+}
+
+func TestRunResumesPausedTurn(t *testing.T) {
+	p := fake.New(t,
+		fake.Respond(provider.StopReasonPauseTurn, provider.NewTextBlock("Still searching...")),
+		fake.Text("Done.").
+			Expect(func(t testing.TB, params provider.ChatParams) {
+				if last := params.Messages[len(params.Messages)-1]; last.Role != provider.RoleAssistant {
+					t.Errorf("paused turn was not sent back as the last message: %+v", last)
+				}
+			}),
+	)
+	a, _ := newTestAgent(t, p, 10)
+
+	result, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Status != StatusCompleted {
+		t.Errorf("status = %s, want %s", result.Status, StatusCompleted)
+	}
+}
+
+func TestRunPausedTurnChecksBudget(t *testing.T) {
+	paused := fake.Respond(provider.StopReasonPauseTurn, provider.NewTextBlock("Still searching...")).
+		WithUsage(provider.Usage{InputTokens: 900, OutputTokens: 200})
+	p := fake.New(t, paused)
+	a, _ := newTestAgent(t, p, 10)
+	a.config.BudgetTokens = 1000
+
+	result, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Status != StatusBudgetExhausted {
+		t.Errorf("status = %s, want %s", result.Status, StatusBudgetExhausted)
+	}
+}
+
+func TestRunDiscardsTruncatedToolCall(t *testing.T) {
+	p := fake.New(t,
+		fake.Respond(provider.StopReasonMaxTokens,
+			fake.Call("call_1", "write_file", json.RawMessage(`{"path": "big.txt", "content": "lots of`)),
+		),
+		fake.Text("Split it up.").
+			Expect(func(t testing.TB, params provider.ChatParams) {
+				if params.MaxTokens <= provider.DefaultMaxTokens {
+					t.Errorf("max tokens = %d, want it raised above %d", params.MaxTokens, provider.DefaultMaxTokens)
+				}
+				for _, msg := range params.Messages {
+					for _, block := range msg.Content {
+						if block.Type == "tool_use" {
+							t.Errorf("truncated tool call was sent back to the model")
+						}
+					}
+				}
+				last := params.Messages[len(params.Messages)-1]
+				if last.Role != provider.RoleUser || !strings.Contains(last.Content[len(last.Content)-1].Text, "write_file") {
+					t.Errorf("last message does not ask to retry write_file: %+v", last)
+				}
+			}),
+	)
+	a, workspace := newTestAgent(t, p, 10)
+	a.config.MaxTokens = provider.DefaultMaxTokens
+
+	if _, err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "big.txt")); !os.IsNotExist(err) {
+		t.Errorf("truncated write_file was executed")
+	}
+}
+
+// readTurns scripts n responses that each read big.go, the first one
+// opening with a plan.
+func readTurns(n int) []fake.Step {
+	steps := make([]fake.Step, n)
+	for i := range steps {
+		call := fake.Call(fmt.Sprintf("call_%d", i+1), "read_file", map[string]string{"path": "big.go"})
+		steps[i] = fake.ToolCalls(call)
+	}
+	steps[0].Response.Content = append([]provider.ContentBlock{provider.NewTextBlock("Plan: read big.go, then fix it.")}, steps[0].Response.Content...)
+	return steps
+}
+
+// newCompactionAgent returns an agent whose model has a small context
+// window, in a workspace holding a big.go of roughly 2,000 tokens.
+func newCompactionAgent(t *testing.T, p provider.Provider, contextWindow int) *Agent {
+	t.Helper()
+	a, workspace := newTestAgent(t, p, 10)
+	big := strings.Repeat("// "+strings.Repeat("x", 70)+"\n", 100)
+	if err := os.WriteFile(filepath.Join(workspace, "big.go"), []byte(big), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a.chain[0].info = provider.ModelInfo{ContextWindow: contextWindow, MaxOutputTokens: 2000, MaxTokens: 1000}
+	return a
+}
+
+func TestRunElidesStaleToolOutputs(t *testing.T) {
+	steps := append(readTurns(5), fake.Text("Done.").
+		Expect(func(t testing.TB, params provider.ChatParams) {
+			if len(params.Messages) != 11 {
+				t.Fatalf("got %d messages, want the full conversation of 11", len(params.Messages))
+			}
+			if first := params.Messages[2].Content[0].ToolResult; !strings.Contains(first, "elided") {
+				t.Errorf("oldest read_file output was not elided: %.80q", first)
+			}
+			if latest := lastToolResult(t, params, "call_5").ToolResult; strings.Contains(latest, "elided") {
+				t.Errorf("recent read_file output was elided")
+			}
+		}))
+	a := newCompactionAgent(t, fake.New(t, steps...), 15_000)
+
+	if _, err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+}
+
+func TestRunSummarizesOlderTurns(t *testing.T) {
+	// The first turn writes a file too big to elide and the next four only
+	// list the workspace, so summarizing the first turn brings the prompt
+	// back under the threshold.
+	write := fake.Call("call_1", "write_file", map[string]string{"path": "big.txt", "content": strings.Repeat("x", 26_000)})
+	steps := []fake.Step{fake.Respond(provider.StopReasonToolUse, provider.NewTextBlock("Plan: write big.txt, then check it."), write)}
+	for i := 2; i <= 5; i++ {
+		steps = append(steps, fake.ToolCalls(fake.Call(fmt.Sprintf("call_%d", i), "list_directory", map[string]string{"path": "."})))
+	}
+	steps = append(steps,
+		fake.Text("Wrote big.txt; it needs checking.").
+			Expect(func(t testing.TB, params provider.ChatParams) {
+				if params.ToolChoice.Mode != provider.ToolChoiceNone {
+					t.Errorf("summary request tool choice = %q, want none", params.ToolChoice.Mode)
+				}
+				last := params.Messages[len(params.Messages)-1]
+				if !strings.Contains(last.Content[len(last.Content)-1].Text, "summary") {
+					t.Errorf("last message does not ask for a summary: %+v", last)
+				}
+			}).
+			WithUsage(provider.Usage{InputTokens: 100, OutputTokens: 10}),
+		fake.Text("Done.").
+			Expect(func(t testing.TB, params provider.ChatParams) {
+				// The initial message plus the last four turns.
+				if len(params.Messages) != 9 {
+					t.Fatalf("got %d messages, want 9", len(params.Messages))
+				}
+				first := params.Messages[0].Content
+				if !strings.Contains(first[0].Text, "repository structure") {
+					t.Errorf("initial message was not kept: %.80q", first[0].Text)
+				}
+				history := first[len(first)-1].Text
+				for _, want := range []string{"Plan: write big.txt", "Wrote big.txt; it needs checking."} {
+					if !strings.Contains(history, want) {
+						t.Errorf("compacted history does not contain %q:\n%s", want, history)
+					}
+				}
+				if params.Messages[1].Role != provider.RoleAssistant || params.Messages[1].Content[0].ToolUseID != "call_2" {
+					t.Errorf("recent turns do not start with the second call: %+v", params.Messages[1])
+				}
+			}),
+	)
+	a := newCompactionAgent(t, fake.New(t, steps...), 10_000)
+
+	result, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Usage.InputTokens != 100 {
+		t.Errorf("usage = %+v, want the summary request counted", result.Usage)
+	}
+}
+
+func TestRunElidesRecentToolOutputs(t *testing.T) {
+	// Three turns are too few to summarize, so the reads in them are elided,
+	// all but the latest, which the model has not seen yet.
+	steps := append(readTurns(3), fake.Text("Done.").
+		Expect(func(t testing.TB, params provider.ChatParams) {
+			if first := params.Messages[2].Content[0].ToolResult; !strings.Contains(first, "elided") {
+				t.Errorf("first read_file output was not elided: %.80q", first)
+			}
+			if latest := lastToolResult(t, params, "call_3").ToolResult; strings.Contains(latest, "elided") {
+				t.Errorf("latest read_file output was elided")
+			}
+		}))
+	a := newCompactionAgent(t, fake.New(t, steps...), 9000)
+
+	if _, err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+}
+
+func TestRunContextOverflow(t *testing.T) {
+	// A prompt that nothing can shrink and that leaves no room for output
+	// is not sent.
+	a := newCompactionAgent(t, countingProvider{fake.New(t), 9500}, 10_000)
+
+	result, err := a.Run(context.Background())
+	if !errors.Is(err, provider.ErrContextOverflow) {
+		t.Errorf("Run error = %v, want a context overflow", err)
+	}
+	if result.Status != StatusContextOverflow {
+		t.Errorf("status = %s, want %s", result.Status, StatusContextOverflow)
+	}
+}
+
+func TestRunToolCallsKeepOrder(t *testing.T) {
+	// The reads around the write run concurrently with their neighbours but
+	// not with the write, so the second read of b.txt sees it.
+	p := fake.New(t,
+		fake.ToolCalls(
+			fake.Call("call_1", "read_file", map[string]string{"path": "main.go"}),
+			fake.Call("call_2", "read_file", map[string]string{"path": "b.txt"}),
+			fake.Call("call_3", "list_directory", map[string]string{"path": "."}),
+			fake.Call("call_4", "write_file", map[string]string{"path": "b.txt", "content": "written\n"}),
+			fake.Call("call_5", "read_file", map[string]string{"path": "b.txt"}),
+			fake.Call("call_6", "search_code", map[string]string{"pattern": "written"}),
+		),
+		fake.Text("Done.").
+			Expect(func(t testing.TB, params provider.ChatParams) {
+				results := params.Messages[len(params.Messages)-1].Content
+				for i, block := range results {
+					if want := fmt.Sprintf("call_%d", i+1); block.ToolResultID != want {
+						t.Errorf("result %d is for %s, want %s", i, block.ToolResultID, want)
+					}
+				}
+				if !strings.Contains(results[0].ToolResult, "package main") {
+					t.Errorf("read of main.go = %q", results[0].ToolResult)
+				}
+				if !results[1].IsError {
+					t.Errorf("read of b.txt before the write succeeded: %q", results[1].ToolResult)
+				}
+				if !strings.Contains(results[4].ToolResult, "written") || !strings.Contains(results[5].ToolResult, "b.txt") {
+					t.Errorf("reads after the write did not see it: %q, %q", results[4].ToolResult, results[5].ToolResult)
+				}
+			}),
+	)
+	a, _ := newTestAgent(t, p, 10)
+
+	result, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if got := strings.Join(result.FilesChanged, ","); got != "b.txt" {
+		t.Errorf("files changed = %q, want b.txt", got)
+	}
+}
+
+func TestRunFallbackRefitsContext(t *testing.T) {
+	primary := fake.New(t, fake.Fail(errors.New("boom")))
+	fallback := fake.New(t, fake.Text("Done.").
+		Expect(func(t testing.TB, params provider.ChatParams) {
+			if prompt := provider.EstimateTokens(params); prompt+params.MaxTokens > 4000 {
+				t.Errorf("prompt of %d tokens plus max tokens %d overflow the fallback's 4000-token window", prompt, params.MaxTokens)
+			}
+		}))
+	a, _ := newTestAgent(t, primary, 10)
+	a.chain[0].info = provider.ModelInfo{ContextWindow: 200_000, MaxOutputTokens: 64_000, MaxTokens: 8192}
+	a.chain = append(a.chain, chainEntry{name: "fallback", model: "small", provider: fallback,
+		info: provider.ModelInfo{ContextWindow: 4000, MaxOutputTokens: 16_000, MaxTokens: 8192}})
+
+	result, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Status != StatusCompleted {
+		t.Errorf("status = %s, want %s", result.Status, StatusCompleted)
+	}
+}
+
+func TestRunFallbackWithoutImages(t *testing.T) {
+	primary := fake.New(t, fake.Fail(errors.New("boom")))
+	fallback := fake.New(t, fake.Text("Done.").
+		Expect(func(t testing.TB, params provider.ChatParams) {
+			first := params.Messages[0].Content
+			if len(first) != 2 || first[1].Type != "text" || !strings.Contains(first[1].Text, "Image omitted") {
+				t.Errorf("initial message = %+v, want the image replaced by a note", first)
+			}
+		}))
+	a, workspace := newTestAgent(t, primary, 10)
+	if err := os.WriteFile(filepath.Join(workspace, "mockup.png"), []byte("\x89PNG"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a.config.Images = []string{"mockup.png"}
+	a.chain[0].info = provider.ModelInfo{ContextWindow: 200_000, MaxOutputTokens: 64_000, MaxTokens: 8192, Images: true}
+	a.chain = append(a.chain, chainEntry{name: "fallback", model: "text-only", provider: fallback,
+		info: provider.ModelInfo{ContextWindow: 200_000, MaxOutputTokens: 16_000, MaxTokens: 8192}})
+
+	if _, err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+}
+
+func TestRunFallbackCompactsAgain(t *testing.T) {
+	// The primary compacts turn 6 to fit its own window and then fails; the
+	// fallback's window is smaller, so it compacts the same turn again.
+	primary := fake.New(t, append(readTurns(5), fake.Fail(errors.New("boom")))...)
+	fallback := fake.New(t,
+		fake.Text("Read big.go; it needs fixing."),
+		fake.Text("Done.").
+			Expect(func(t testing.TB, params provider.ChatParams) {
+				if prompt := provider.EstimateTokens(params); prompt+params.MaxTokens > 8000 {
+					t.Errorf("prompt of %d tokens plus max tokens %d overflow the fallback's 8000-token window", prompt, params.MaxTokens)
+				}
+			}))
+	a := newCompactionAgent(t, primary, 15_000)
+	a.chain = append(a.chain, chainEntry{name: "fallback", model: "small", provider: fallback,
+		info: provider.ModelInfo{ContextWindow: 8000, MaxOutputTokens: 2000, MaxTokens: 1000}})
+
+	result, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Status != StatusCompleted {
+		t.Errorf("status = %s, want %s", result.Status, StatusCompleted)
+	}
+}
+
+func TestRunSerialToolsForModel(t *testing.T) {
+	for _, parallel := range []bool{true, false} {
+		p := fake.New(t, fake.Text("Done.").
+			Expect(func(t testing.TB, params provider.ChatParams) {
+				if params.SerialTools == parallel {
+					t.Errorf("parallel tools %v: request SerialTools = %v", parallel, params.SerialTools)
+				}
+			}))
+		a, _ := newTestAgent(t, p, 10)
+		a.chain[0].info = provider.ModelInfo{ContextWindow: 200_000, MaxOutputTokens: 64_000, MaxTokens: 8192, ParallelTools: parallel}
+
+		if _, err := a.Run(context.Background()); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+	}
+}
+
+func TestRunUsesModelMaxTokens(t *testing.T) {
+	p := fake.New(t, fake.Text("Done.").
+		Expect(func(t testing.TB, params provider.ChatParams) {
+			if params.MaxTokens != 32_000 {
+				t.Errorf("max tokens = %d, want the model's 32000", params.MaxTokens)
+			}
+		}))
+	a, _ := newTestAgent(t, p, 10)
+	a.chain[0].info = provider.ModelInfo{ContextWindow: 200_000, MaxOutputTokens: 64_000, MaxTokens: 32_000}
+
+	if _, err := a.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+}
+
+// countingProvider reports a fixed prompt size instead of the estimate, like
+// a provider whose tokenizer disagrees with provider.EstimateTokens.
+type countingProvider struct {
+	*fake.Provider
+	tokens int
+}
+
+func (c countingProvider) CountTokens(ctx context.Context, params provider.ChatParams) (int, error) {
+	return c.tokens, nil
+}
+
+func TestRunRecordThenReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	info := provider.ModelInfo{ContextWindow: 20_000, MaxOutputTokens: 8000, MaxTokens: 4000}
+
+	// The counted prompt leaves room for only 2000 output tokens, so the
+	// recorded requests differ from what estimating would produce.
+	p := fake.New(t,
+		fake.ToolCalls(fake.Call("call_1", "write_file", map[string]string{"path": "a.txt", "content": "a\n"})),
+		fake.Text("Done."),
+	)
+	a, _ := newTestAgent(t, provider.NewRecorder(countingProvider{p, 18_000}, path), 10)
+	a.chain[0].info = info
+	a.config.CompactAt = -1
+	recorded, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatalf("recording Run: %v", err)
+	}
+
+	replay, err := provider.NewReplay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := newTestAgent(t, replay, 10)
+	b.chain[0].info = info
+	b.config.CompactAt = -1
+	replayed, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatalf("replaying Run: %v", err)
+	}
+	if replayed.Status != recorded.Status || strings.Join(replayed.FilesChanged, ",") != strings.Join(recorded.FilesChanged, ",") {
+		t.Errorf("replay = %s %v, recording = %s %v", replayed.Status, replayed.FilesChanged, recorded.Status, recorded.FilesChanged)
+	}
+}
@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/AkshayNayak/ticketflow/action/internal/provider"
+)
+
+// budgetWarnFraction is the share of the budget after which the model is
+// told to wrap up.
+const budgetWarnFraction = 0.8
+
+// budget tracks a run's spend against its dollar and token limits.
+// A zero limit means unlimited. Usage is priced per provider/model since a
+// fallback chain may switch models mid-run.
+type budget struct {
+	maxCostUSD float64
+	maxTokens  int
+	pricing    provider.PriceTable
+
+	costUSD  float64
+	tokens   int
+	unpriced map[string]bool // provider/model pairs with no known price
+	warned   bool
+}
+
+func newBudget(cfg Config) *budget {
+	return &budget{
+		maxCostUSD: cfg.BudgetUSD,
+		maxTokens:  cfg.BudgetTokens,
+		pricing:    cfg.Pricing,
+		unpriced:   make(map[string]bool),
+	}
+}
+
+// add records the usage of one response from the given provider and model.
+func (b *budget) add(providerName, model string, u provider.Usage) {
+	b.tokens += u.InputTokens + u.OutputTokens + u.CacheReadTokens + u.CacheWriteTokens
+
+	price, ok := provider.LookupPrice(b.pricing, providerName, model)
+	if !ok {
+		key := providerName + "/" + model
+		if b.maxCostUSD > 0 && !b.unpriced[key] {
+			log.Printf("Warning: no pricing known for %s — its usage does not count toward the dollar budget, set pricing to override", key)
+		}
+		b.unpriced[key] = true
+		return
+	}
+	b.costUSD += price.Cost(u)
+}
+
+// cost returns the estimated USD cost so far, excluding unpriced models.
+func (b *budget) cost() float64 {
+	return b.costUSD
+}
+
+// used returns the fraction of the tightest limit consumed so far.
+func (b *budget) used() float64 {
+	var fraction float64
+	if b.maxCostUSD > 0 {
+		fraction = b.costUSD / b.maxCostUSD
+	}
+	if b.maxTokens > 0 {
+		fraction = max(fraction, float64(b.tokens)/float64(b.maxTokens))
+	}
+	return fraction
+}
+
+// exhausted reports whether a limit has been reached.
+func (b *budget) exhausted() bool {
+	return b.used() >= 1
+}
+
+// warning returns a one-time note for the model once usage crosses the warn
+// threshold, or "" if no warning is due.
+func (b *budget) warning() string {
+	used := b.used()
+	if b.warned || used < budgetWarnFraction {
+		return ""
+	}
+	b.warned = true
+	return fmt.Sprintf("Note: %.0f%% of this run's budget has been used. Finish the most important remaining changes now and end your turn with a short summary; the run will stop when the budget is exhausted.", used*100)
+}
@@ -0,0 +1,196 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/AkshayNayak/ticketflow/action/internal/provider"
+)
+
+// compactKeepTurns is the number of most recent turns kept verbatim when the
+// conversation is compacted.
+const compactKeepTurns = 4
+
+// compactSummaryTokens caps the length of the summary of older turns.
+const compactSummaryTokens = 2048
+
+// elideMinBytes is the size below which a stale tool output is kept, since
+// eliding it would save next to nothing.
+const elideMinBytes = 512
+
+// elidableTools are the tools whose outputs go stale and can simply be
+// fetched again.
+var elidableTools = map[string]bool{"read_file": true, "search_code": true}
+
+// compactor shrinks a conversation that has outgrown the compaction
+// threshold. The initial message (ticket context and images), the model's
+// plan and the most recent turns are always kept verbatim. Stale read_file
+// and search_code outputs in older turns are elided first; if that is not
+// enough, the older turns are replaced by a summary written by the model.
+type compactor struct {
+	initial       provider.Message // the first user message of the run
+	plan          string           // text of the model's first response
+	planned       bool             // whether plan has been captured
+	compactedTurn int              // the last turn compaction ran on, or 0
+	compactedFor  int              // the chain entry it ran for
+}
+
+func newCompactor(initial provider.Message) *compactor {
+	return &compactor{initial: initial}
+}
+
+// compact shrinks the conversation in params, currently tokens long, until
+// its prompt fits under threshold tokens, if it can. It returns the new
+// messages and their prompt size, or nil if nothing could be compacted,
+// along with the usage of the summarization request.
+func (a *Agent) compact(ctx context.Context, turn int, c *compactor, params provider.ChatParams, tokens, threshold int) ([]provider.Message, int, provider.Usage) {
+	messages := params.Messages
+	var compacted []provider.Message
+	var spent provider.Usage
+
+	keep := recentTurnsStart(messages, compactKeepTurns)
+	if keep < 3 {
+		log.Printf("[turn %d] Conversation is too short to summarize", turn)
+	} else {
+		if !c.planned {
+			c.plan = messageText(messages[1])
+			c.planned = true
+		}
+
+		// Stale tool outputs go first; dropping them may be enough on its own.
+		elided, n := elideStaleOutputs(messages[:keep])
+		elided = append(elided, messages[keep:]...)
+		if n > 0 {
+			log.Printf("[turn %d] Elided %d stale tool outputs", turn, n)
+			params.Messages = elided
+			compacted, tokens = elided, a.countTokens(ctx, turn, params)
+			if tokens <= threshold {
+				return compacted, tokens, spent
+			}
+		}
+
+		var summary string
+		var err error
+		summary, spent, err = a.summarize(ctx, elided[:keep], params)
+		if err != nil {
+			log.Printf("[turn %d] Could not summarize older turns: %v", turn, err)
+		} else {
+			first := provider.UserMessage(append(slices.Clone(c.initial.Content), provider.NewTextBlock(BuildCompactedHistoryMessage(c.plan, summary)))...)
+			params.Messages = append([]provider.Message{first}, elided[keep:]...)
+			if n := a.countTokens(ctx, turn, params); n < tokens {
+				log.Printf("[turn %d] Summarized %d older messages", turn, keep-1)
+				compacted, tokens = params.Messages, n
+				if tokens <= threshold {
+					return compacted, tokens, spent
+				}
+			} else {
+				log.Printf("[turn %d] Discarding the summary of %d older messages, which would grow the prompt from %d to %d tokens", turn, keep-1, tokens, n)
+			}
+		}
+	}
+
+	// As a last resort, outputs in the recent turns go too, all but the
+	// latest ones, which the model has not seen yet.
+	if compacted != nil {
+		messages = compacted
+	}
+	last := len(messages) - 1
+	elided, n := elideStaleOutputs(messages[:last])
+	if n > 0 {
+		log.Printf("[turn %d] Elided %d stale tool outputs from recent turns", turn, n)
+		params.Messages = append(elided, messages[last])
+		compacted, tokens = params.Messages, a.countTokens(ctx, turn, params)
+	}
+	return compacted, tokens, spent
+}
+
+// summarize asks the active provider to summarize the given older messages,
+// which must end with a user message.
+func (a *Agent) summarize(ctx context.Context, older []provider.Message, params provider.ChatParams) (string, provider.Usage, error) {
+	entry := a.chain[a.active]
+	last := older[len(older)-1]
+	request := provider.UserMessage(append(slices.Clone(last.Content), provider.NewTextBlock(BuildCompactionRequest()))...)
+
+	// Tools stay defined because the history contains tool calls, but the
+	// model may not call any.
+	resp, err := entry.provider.Chat(ctx, provider.ChatParams{
+		System:     params.System,
+		Messages:   append(slices.Clone(older[:len(older)-1]), request),
+		Tools:      params.Tools,
+		ToolChoice: provider.ToolChoice{Mode: provider.ToolChoiceNone},
+		MaxTokens:  min(compactSummaryTokens, entry.info.MaxOutputTokens),
+	})
+	if err != nil {
+		return "", provider.Usage{}, err
+	}
+	summary := messageText(provider.AssistantMessage(resp.Content...))
+	if summary == "" {
+		return "", resp.Usage, fmt.Errorf("the model returned an empty summary")
+	}
+	return summary, resp.Usage, nil
+}
+
+// recentTurnsStart returns the index of the assistant message that starts
+// the last n turns, or -1 if the conversation has fewer turns. A turn starts
+// at an assistant message that follows a user message, so the cut never
+// separates tool calls from their results or a paused turn from its
+// continuation.
+func recentTurnsStart(messages []provider.Message, n int) int {
+	for i := len(messages) - 1; i > 0; i-- {
+		if messages[i].Role == provider.RoleAssistant && messages[i-1].Role == provider.RoleUser {
+			if n--; n == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// elideStaleOutputs returns a copy of messages with large read_file and
+// search_code results replaced by a short note, and the number replaced.
+// The input messages are not modified.
+func elideStaleOutputs(messages []provider.Message) ([]provider.Message, int) {
+	calls := make(map[string]provider.ContentBlock)
+	for _, msg := range messages {
+		for _, block := range msg.Content {
+			if block.Type == "tool_use" {
+				calls[block.ToolUseID] = block
+			}
+		}
+	}
+
+	out := slices.Clone(messages)
+	n := 0
+	for i, msg := range messages {
+		var content []provider.ContentBlock
+		for j, block := range msg.Content {
+			call, ok := calls[block.ToolResultID]
+			if block.Type != "tool_result" || !ok || !elidableTools[call.ToolName] || len(block.ToolResult) < elideMinBytes {
+				continue
+			}
+			if content == nil {
+				content = slices.Clone(msg.Content)
+			}
+			content[j].ToolResult = fmt.Sprintf("[Output of %s %s elided to save context. Call the tool again if you still need it.]", call.ToolName, call.ToolInput)
+			n++
+		}
+		if content != nil {
+			out[i].Content = content
+		}
+	}
+	return out, n
+}
+
+// messageText joins the text blocks of a message.
+func messageText(msg provider.Message) string {
+	var texts []string
+	for _, block := range msg.Content {
+		if block.Type == "text" && block.Text != "" {
+			texts = append(texts, block.Text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
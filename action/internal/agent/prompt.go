@@ -1,6 +1,9 @@
 package agent
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // BuildSystemPrompt constructs the system prompt for the Claude agent.
 func BuildSystemPrompt(ticketKey, ticketTitle, ticketDescription string) string {
@@ -31,10 +34,58 @@ Description:
 }
 
 // BuildInitialUserMessage constructs the first user message with repo context.
-func BuildInitialUserMessage(repoTree string) string {
-	return fmt.Sprintf(`Here is the current repository structure:
+// imageNames lists any ticket images attached after the message.
+func BuildInitialUserMessage(repoTree string, imageNames []string) string {
+	msg := fmt.Sprintf(`Here is the current repository structure:
 
 %s
 
 Please implement the Jira ticket described in the system prompt. Start by exploring the codebase to understand its structure, then make the necessary changes.`, repoTree)
+
+	if len(imageNames) > 0 {
+		msg += fmt.Sprintf(`
+
+The ticket includes the following images (screenshots or design mockups), attached below in this order: %s. Use them to understand the bug or the intended UI.`, strings.Join(imageNames, ", "))
+	}
+	return msg
+}
+
+// BuildContinuationMessage asks the model to pick up after a response that hit
+// the output token limit. discarded names the tool calls that were cut off
+// mid-arguments and therefore not executed.
+func BuildContinuationMessage(discarded []string) string {
+	if len(discarded) == 0 {
+		return "Your previous response was cut off because it reached the output token limit. Continue exactly where you left off."
+	}
+	return fmt.Sprintf("Your previous response was cut off because it reached the output token limit, so the incomplete %s call was discarded and NOT executed. Retry it, but keep each call small: split large files into a short write_file followed by several edit_file calls that append the rest.", strings.Join(discarded, ", "))
+}
+
+// BuildFinalTurnMessage warns the model that its next response is the last
+// one of the run and that tools will be unavailable.
+func BuildFinalTurnMessage() string {
+	return "Note: the next response is the last turn of this run and tools are disabled for it. Summarize the changes you made and list anything from the ticket that is still unfinished."
+}
+
+// BuildCompactionRequest asks the model to summarize the conversation so far,
+// so that older turns can be replaced by the summary.
+func BuildCompactionRequest() string {
+	return `The conversation is about to be shortened to fit the context window. Instead of calling a tool, write a concise summary of the work so far that will replace the earlier turns. Include:
+- the files you examined and what you learned from them that is still relevant,
+- every change you made, by file,
+- decisions taken and approaches that did not work,
+- what remains to be done.
+Be specific: name files, functions and identifiers. Do not repeat file contents.`
+}
+
+// BuildCompactedHistoryMessage introduces the summary that replaces older
+// turns of the conversation. plan is the model's opening response, kept
+// verbatim; it may be empty.
+func BuildCompactedHistoryMessage(plan, summary string) string {
+	var b strings.Builder
+	b.WriteString("Earlier turns of this conversation were removed to save context.")
+	if plan != "" {
+		fmt.Fprintf(&b, "\n\n## Your initial plan\n%s", plan)
+	}
+	fmt.Fprintf(&b, "\n\n## Summary of the work so far\n%s\n\nContinue from here. Read files again if you need their current contents.", summary)
+	return b.String()
 }
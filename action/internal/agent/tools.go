@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os/exec"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/AkshayNayak/ticketflow/action/internal/files"
@@ -17,88 +18,80 @@ func ToolDefinitions() []provider.Tool {
 		{
 			Name:        "read_file",
 			Description: "Read the contents of a file. Returns the file with line numbers.",
-			Parameters: map[string]interface{}{
-				"path": map[string]interface{}{
-					"type":        "string",
-					"description": "The file path relative to the repository root.",
+			Parameters: &provider.Schema{
+				Type: provider.TypeObject,
+				Properties: map[string]*provider.Schema{
+					"path": {Type: provider.TypeString, Description: "The file path relative to the repository root."},
 				},
+				Required: []string{"path"},
 			},
-			Required: []string{"path"},
 		},
 		{
 			Name:        "write_file",
 			Description: "Create a new file or completely overwrite an existing file with the given content.",
-			Parameters: map[string]interface{}{
-				"path": map[string]interface{}{
-					"type":        "string",
-					"description": "The file path relative to the repository root.",
-				},
-				"content": map[string]interface{}{
-					"type":        "string",
-					"description": "The complete file content to write.",
+			Parameters: &provider.Schema{
+				Type: provider.TypeObject,
+				Properties: map[string]*provider.Schema{
+					"path":    {Type: provider.TypeString, Description: "The file path relative to the repository root."},
+					"content": {Type: provider.TypeString, Description: "The complete file content to write."},
 				},
+				Required: []string{"path", "content"},
 			},
-			Required: []string{"path", "content"},
 		},
 		{
 			Name:        "edit_file",
 			Description: "Edit a file by replacing a specific string with a new string. The old_string must appear exactly once in the file.",
-			Parameters: map[string]interface{}{
-				"path": map[string]interface{}{
-					"type":        "string",
-					"description": "The file path relative to the repository root.",
-				},
-				"old_string": map[string]interface{}{
-					"type":        "string",
-					"description": "The exact string to find and replace. Must be unique in the file.",
-				},
-				"new_string": map[string]interface{}{
-					"type":        "string",
-					"description": "The string to replace old_string with.",
+			Parameters: &provider.Schema{
+				Type: provider.TypeObject,
+				Properties: map[string]*provider.Schema{
+					"path":       {Type: provider.TypeString, Description: "The file path relative to the repository root."},
+					"old_string": {Type: provider.TypeString, Description: "The exact string to find and replace. Must be unique in the file."},
+					"new_string": {Type: provider.TypeString, Description: "The string to replace old_string with."},
 				},
+				Required: []string{"path", "old_string", "new_string"},
 			},
-			Required: []string{"path", "old_string", "new_string"},
 		},
 		{
 			Name:        "list_directory",
 			Description: "List files and subdirectories at the given path.",
-			Parameters: map[string]interface{}{
-				"path": map[string]interface{}{
-					"type":        "string",
-					"description": "The directory path relative to the repository root. Use '.' for the root.",
+			Parameters: &provider.Schema{
+				Type: provider.TypeObject,
+				Properties: map[string]*provider.Schema{
+					"path": {Type: provider.TypeString, Description: "The directory path relative to the repository root. Use '.' for the root."},
 				},
+				Required: []string{"path"},
 			},
-			Required: []string{"path"},
 		},
 		{
 			Name:        "search_code",
 			Description: "Search for a text pattern in files under the given directory. Returns matching lines with file paths and line numbers.",
-			Parameters: map[string]interface{}{
-				"pattern": map[string]interface{}{
-					"type":        "string",
-					"description": "The text pattern to search for.",
-				},
-				"path": map[string]interface{}{
-					"type":        "string",
-					"description": "The directory to search in, relative to repo root. Use '.' for the entire repo.",
+			Parameters: &provider.Schema{
+				Type: provider.TypeObject,
+				Properties: map[string]*provider.Schema{
+					"pattern": {Type: provider.TypeString, Description: "The text pattern to search for."},
+					"path":    {Type: provider.TypeString, Description: "The directory to search in, relative to repo root. Use '.' for the entire repo.", Default: "."},
 				},
+				Required: []string{"pattern"},
 			},
-			Required: []string{"pattern"},
 		},
 		{
 			Name:        "run_command",
 			Description: "Execute a shell command in the repository directory. Use for running tests, linters, or build commands. Commands are sandboxed to the repository.",
-			Parameters: map[string]interface{}{
-				"command": map[string]interface{}{
-					"type":        "string",
-					"description": "The shell command to execute.",
+			Parameters: &provider.Schema{
+				Type: provider.TypeObject,
+				Properties: map[string]*provider.Schema{
+					"command": {Type: provider.TypeString, Description: "The shell command to execute."},
 				},
+				Required: []string{"command"},
 			},
-			Required: []string{"command"},
 		},
 	}
 }
 
+// readOnlyTools are the tools with no side effects, which may run
+// concurrently with each other.
+var readOnlyTools = map[string]bool{"read_file": true, "search_code": true, "list_directory": true}
+
 // HandleToolCall executes a tool call and returns the result string.
 func HandleToolCall(workspace string, name string, inputRaw json.RawMessage, tracker *ChangeTracker) (string, bool) {
 	var input map[string]interface{}
@@ -200,7 +193,9 @@ func runCommand(workspace, command string) (string, error) {
 }
 
 // ChangeTracker keeps track of files created or modified by the agent.
+// It is safe for concurrent use.
 type ChangeTracker struct {
+	mu    sync.Mutex
 	files map[string]bool
 }
 
@@ -211,11 +206,15 @@ func NewChangeTracker() *ChangeTracker {
 
 // Track records a file as changed.
 func (ct *ChangeTracker) Track(path string) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
 	ct.files[path] = true
 }
 
 // Files returns the list of changed file paths.
 func (ct *ChangeTracker) Files() []string {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
 	result := make([]string, 0, len(ct.files))
 	for f := range ct.files {
 		result = append(result, f)
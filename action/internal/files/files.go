@@ -42,6 +42,46 @@ func ReadFile(workspace, path string) (string, error) {
 	return b.String(), nil
 }
 
+// maxImageSize is the largest image accepted, matching the strictest
+// provider limit (Anthropic's 5MB per image).
+const maxImageSize = 5 * 1024 * 1024
+
+// imageTypes maps supported image extensions to their media types.
+var imageTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// ReadImage reads an image file and returns its bytes and media type.
+func ReadImage(workspace, path string) ([]byte, string, error) {
+	absPath, err := SafePath(workspace, path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	mediaType, ok := imageTypes[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported image type %s — supported: png, jpeg, gif, webp", path)
+	}
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if info.Size() > maxImageSize {
+		return nil, "", fmt.Errorf("image %s is %d bytes, larger than the %d byte limit", path, info.Size(), maxImageSize)
+	}
+
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return data, mediaType, nil
+}
+
 // WriteFile creates or overwrites a file with the given content.
 // Creates parent directories as needed.
 func WriteFile(workspace, path, content string) error {
@@ -0,0 +1,224 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Cassette is a recorded sequence of chat requests and responses, along with
+// the prompt sizes reported by token counting in the order they were asked
+// for. Replaying the counts keeps context fitting and compaction decisions,
+// and therefore the requests, identical to the recorded run.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+	TokenCounts  []int         `json:"token_counts,omitempty"`
+}
+
+// Interaction is a single recorded request/response pair.
+type Interaction struct {
+	Request  ChatParams    `json:"request"`
+	Response *ChatResponse `json:"response"`
+}
+
+// LoadCassette reads a cassette file.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette %s: %w", path, err)
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette to path as indented JSON.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette %s: %w", path, err)
+	}
+	return nil
+}
+
+// Recorder saves request/response pairs from one or more providers to a
+// single cassette file. The file is rewritten after each call so a run that
+// aborts midway still leaves a usable cassette.
+type Recorder struct {
+	path     string
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewCassetteRecorder creates a recorder that writes to path.
+func NewCassetteRecorder(path string) *Recorder {
+	return &Recorder{path: path}
+}
+
+// Wrap returns a provider that forwards to inner and records every
+// successful exchange.
+func (r *Recorder) Wrap(inner Provider) Provider {
+	return &recordingProvider{inner: inner, recorder: r}
+}
+
+func (r *Recorder) record(params ChatParams, resp *ChatResponse) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{Request: params, Response: resp})
+	return r.cassette.Save(r.path)
+}
+
+func (r *Recorder) recordTokens(n int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cassette.TokenCounts = append(r.cassette.TokenCounts, n)
+	return r.cassette.Save(r.path)
+}
+
+// NewRecorder wraps a provider and saves every successful request/response
+// pair to the cassette at path.
+func NewRecorder(inner Provider, path string) Provider {
+	return NewCassetteRecorder(path).Wrap(inner)
+}
+
+type recordingProvider struct {
+	inner    Provider
+	recorder *Recorder
+}
+
+func (r *recordingProvider) Chat(ctx context.Context, params ChatParams) (*ChatResponse, error) {
+	resp, err := r.inner.Chat(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return resp, r.recorder.record(params, resp)
+}
+
+func (r *recordingProvider) ChatStream(ctx context.Context, params ChatParams, onEvent StreamHandler) (*ChatResponse, error) {
+	resp, err := r.inner.ChatStream(ctx, params, onEvent)
+	if err != nil {
+		return nil, err
+	}
+	return resp, r.recorder.record(params, resp)
+}
+
+// CountTokens records the count, or the estimate the agent falls back to when
+// counting fails, so that replay sees the same number either way.
+func (r *recordingProvider) CountTokens(ctx context.Context, params ChatParams) (int, error) {
+	n, err := r.inner.CountTokens(ctx, params)
+	if err != nil {
+		if recErr := r.recorder.recordTokens(EstimateTokens(params)); recErr != nil {
+			return 0, recErr
+		}
+		return 0, err
+	}
+	return n, r.recorder.recordTokens(n)
+}
+
+type replayProvider struct {
+	mu           sync.Mutex
+	interactions []Interaction
+	next         int
+	tokenCounts  []int
+}
+
+// NewReplay creates a provider that serves responses from a cassette in
+// order. Each incoming request must match the recorded one exactly;
+// otherwise the call fails with a description of the first difference.
+func NewReplay(path string) (Provider, error) {
+	c, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return &replayProvider{interactions: c.Interactions, tokenCounts: c.TokenCounts}, nil
+}
+
+func (r *replayProvider) Chat(ctx context.Context, params ChatParams) (*ChatResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.next >= len(r.interactions) {
+		return nil, fmt.Errorf("replay: unexpected request %d, cassette has only %d interactions", r.next+1, len(r.interactions))
+	}
+	recorded := r.interactions[r.next]
+	if diff := diffParams(recorded.Request, params); diff != "" {
+		return nil, fmt.Errorf("replay: request %d does not match cassette: %s", r.next+1, diff)
+	}
+	r.next++
+	return recorded.Response, nil
+}
+
+func (r *replayProvider) ChatStream(ctx context.Context, params ChatParams, onEvent StreamHandler) (*ChatResponse, error) {
+	resp, err := r.Chat(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			onEvent(StreamEvent{Type: StreamEventTextDelta, Text: block.Text})
+		case "tool_use":
+			onEvent(StreamEvent{Type: StreamEventToolUseStart, ToolUseID: block.ToolUseID, ToolName: block.ToolName})
+			onEvent(StreamEvent{Type: StreamEventToolUseDelta, ToolUseID: block.ToolUseID, ToolName: block.ToolName, InputDelta: string(block.ToolInput)})
+		}
+	}
+	return resp, nil
+}
+
+// CountTokens returns the recorded counts in order. Once they run out, as
+// with cassettes recorded before counts were kept, it estimates offline so
+// replays never need the network.
+func (r *replayProvider) CountTokens(ctx context.Context, params ChatParams) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.tokenCounts) == 0 {
+		return EstimateTokens(params), nil
+	}
+	n := r.tokenCounts[0]
+	r.tokenCounts = r.tokenCounts[1:]
+	return n, nil
+}
+
+// diffParams describes the first difference between two requests, or
+// returns "" if they are equivalent once encoded as JSON.
+func diffParams(want, got ChatParams) string {
+	if want.System != got.System {
+		return "system prompt differs"
+	}
+	if !jsonEqual(want.Tools, got.Tools) {
+		return "tool definitions differ"
+	}
+	if want.MaxTokens != got.MaxTokens {
+		return fmt.Sprintf("max tokens: want %d, got %d", want.MaxTokens, got.MaxTokens)
+	}
+	if len(want.Messages) != len(got.Messages) {
+		return fmt.Sprintf("message count: want %d, got %d", len(want.Messages), len(got.Messages))
+	}
+	for i := range want.Messages {
+		if !jsonEqual(want.Messages[i], got.Messages[i]) {
+			w, _ := json.Marshal(want.Messages[i])
+			g, _ := json.Marshal(got.Messages[i])
+			return fmt.Sprintf("message %d differs:\n  want: %s\n  got:  %s", i, w, g)
+		}
+	}
+	if !jsonEqual(want, got) {
+		return "request parameters differ"
+	}
+	return ""
+}
+
+func jsonEqual(a, b any) bool {
+	aj, errA := json.Marshal(a)
+	bj, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(aj) == string(bj)
+}
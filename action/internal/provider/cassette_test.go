@@ -0,0 +1,104 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type stubProvider struct {
+	responses []*ChatResponse
+}
+
+func (s *stubProvider) Chat(ctx context.Context, params ChatParams) (*ChatResponse, error) {
+	resp := s.responses[0]
+	s.responses = s.responses[1:]
+	return resp, nil
+}
+
+func (s *stubProvider) ChatStream(ctx context.Context, params ChatParams, onEvent StreamHandler) (*ChatResponse, error) {
+	return s.Chat(ctx, params)
+}
+
+func (s *stubProvider) CountTokens(ctx context.Context, params ChatParams) (int, error) {
+	return EstimateTokens(params), nil
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	ctx := context.Background()
+
+	first := ChatParams{
+		System:   "system",
+		Messages: []Message{UserMessage(NewTextBlock("implement it"))},
+		Tools: []Tool{{Name: "read_file", Parameters: &Schema{
+			Type:       TypeObject,
+			Properties: map[string]*Schema{"path": {Type: TypeString}},
+		}}},
+	}
+	toolUse := NewToolUseBlock("call_1", "read_file", json.RawMessage(`{"path": "main.go"}`))
+	second := first
+	second.Messages = append(second.Messages,
+		AssistantMessage(toolUse),
+		UserMessage(NewToolResultBlock("call_1", "package main", false)),
+	)
+
+	stub := &stubProvider{responses: []*ChatResponse{
+		{Content: []ContentBlock{toolUse}, StopReason: StopReasonToolUse},
+		{Content: []ContentBlock{NewTextBlock("done")}, StopReason: StopReasonEndTurn, Usage: Usage{InputTokens: 10, OutputTokens: 2}},
+	}}
+	recorder := NewRecorder(stub, path)
+	if _, err := recorder.Chat(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recorder.ChatStream(ctx, second, func(StreamEvent) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := NewReplay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := replay.Chat(ctx, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Content) != 1 || resp.Content[0].ToolName != "read_file" || resp.Content[0].ToolUseID != "call_1" {
+		t.Errorf("first replayed response = %+v", resp.Content)
+	}
+
+	var streamed strings.Builder
+	resp, err = replay.ChatStream(ctx, second, func(e StreamEvent) { streamed.WriteString(e.Text) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if streamed.String() != "done" || resp.Usage.OutputTokens != 2 {
+		t.Errorf("second replayed response: streamed %q, usage %+v", streamed.String(), resp.Usage)
+	}
+
+	if _, err := replay.Chat(ctx, second); err == nil || !strings.Contains(err.Error(), "only 2 interactions") {
+		t.Errorf("expected exhausted cassette error, got %v", err)
+	}
+}
+
+func TestReplayRejectsMismatchedRequest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	c := Cassette{Interactions: []Interaction{{
+		Request:  ChatParams{System: "system", Messages: []Message{UserMessage(NewTextBlock("a"))}},
+		Response: &ChatResponse{StopReason: StopReasonEndTurn},
+	}}}
+	if err := c.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := NewReplay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = replay.Chat(context.Background(), ChatParams{System: "system", Messages: []Message{UserMessage(NewTextBlock("b"))}})
+	if err == nil || !strings.Contains(err.Error(), "message 0 differs") {
+		t.Errorf("expected message mismatch error, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package provider
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 
@@ -16,28 +17,108 @@ type claudeProvider struct {
 
 func NewClaude(apiKey, model string) Provider {
 	if model == "" {
-		model = "claude-sonnet-4-5-20250929"
+		model = DefaultClaudeModel
 	}
-	client := anthropic.NewClient(option.WithAPIKey(apiKey))
+	client := anthropic.NewClient(option.WithAPIKey(apiKey), option.WithMaxRetries(0))
 	return &claudeProvider{client: &client, model: model}
 }
 
 func (c *claudeProvider) Chat(ctx context.Context, params ChatParams) (*ChatResponse, error) {
+	resp, err := c.client.Messages.New(ctx, c.buildRequest(params))
+	if err != nil {
+		return nil, wrapAPIError("claude", err)
+	}
+	return convertClaudeResponse(resp), nil
+}
+
+func (c *claudeProvider) ChatStream(ctx context.Context, params ChatParams, onEvent StreamHandler) (*ChatResponse, error) {
+	stream := c.client.Messages.NewStreaming(ctx, c.buildRequest(params))
+	defer stream.Close()
+
+	// Tool inputs are collected by call ID rather than by Accumulate, which
+	// fails on the partial JSON of a call cut off by max_tokens. The agent
+	// needs that call back, with the max_tokens stop reason, to discard it.
+	message := anthropic.Message{}
+	inputs := make(map[string]json.RawMessage)
+	for stream.Next() {
+		event := stream.Current()
+		if ev, ok := event.AsAny().(anthropic.ContentBlockDeltaEvent); !ok || ev.Delta.Type != "input_json_delta" {
+			if err := message.Accumulate(event); err != nil {
+				return nil, fmt.Errorf("claude stream error: %w", err)
+			}
+		}
+
+		switch ev := event.AsAny().(type) {
+		case anthropic.ContentBlockStartEvent:
+			if ev.ContentBlock.Type == "tool_use" {
+				onEvent(StreamEvent{Type: StreamEventToolUseStart, ToolUseID: ev.ContentBlock.ID, ToolName: ev.ContentBlock.Name})
+			}
+		case anthropic.ContentBlockDeltaEvent:
+			switch delta := ev.Delta.AsAny().(type) {
+			case anthropic.TextDelta:
+				onEvent(StreamEvent{Type: StreamEventTextDelta, Text: delta.Text})
+			case anthropic.ThinkingDelta:
+				onEvent(StreamEvent{Type: StreamEventThinkingDelta, Text: delta.Thinking})
+			case anthropic.InputJSONDelta:
+				block := message.Content[len(message.Content)-1]
+				inputs[block.ID] = append(inputs[block.ID], delta.PartialJSON...)
+				onEvent(StreamEvent{Type: StreamEventToolUseDelta, ToolUseID: block.ID, ToolName: block.Name, InputDelta: delta.PartialJSON})
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, wrapAPIError("claude", err)
+	}
+
+	resp := convertClaudeResponse(&message)
+	for i, block := range resp.Content {
+		if input := inputs[block.ToolUseID]; block.Type == "tool_use" && len(input) > 0 {
+			resp.Content[i].ToolInput = input
+		}
+	}
+	return resp, nil
+}
+
+func (c *claudeProvider) CountTokens(ctx context.Context, params ChatParams) (int, error) {
+	req := c.buildRequest(params)
+	tools := make([]anthropic.MessageCountTokensToolUnionParam, len(req.Tools))
+	for i, t := range req.Tools {
+		tools[i] = anthropic.MessageCountTokensToolUnionParam{OfTool: t.OfTool}
+	}
+
+	count, err := c.client.Messages.CountTokens(ctx, anthropic.MessageCountTokensParams{
+		Model:      req.Model,
+		Messages:   req.Messages,
+		System:     anthropic.MessageCountTokensParamsSystemUnion{OfTextBlockArray: req.System},
+		Tools:      tools,
+		Thinking:   req.Thinking,
+		ToolChoice: req.ToolChoice,
+	})
+	if err != nil {
+		return 0, wrapAPIError("claude", err)
+	}
+	return int(count.InputTokens), nil
+}
+
+// buildRequest converts provider-neutral chat params into an Anthropic request.
+func (c *claudeProvider) buildRequest(params ChatParams) anthropic.MessageNewParams {
 	maxTokens := params.MaxTokens
 	if maxTokens == 0 {
-		maxTokens = 8192
+		info, _ := LookupModel(nil, c.model)
+		maxTokens = info.MaxTokens
 	}
 
 	// Convert tools
 	tools := make([]anthropic.ToolUnionParam, len(params.Tools))
 	for i, t := range params.Tools {
+		schema := t.inputSchema()
 		tools[i] = anthropic.ToolUnionParam{
 			OfTool: &anthropic.ToolParam{
 				Name:        t.Name,
 				Description: anthropic.String(t.Description),
 				InputSchema: anthropic.ToolInputSchemaParam{
-					Properties: t.Parameters,
-					Required:   t.Required,
+					Properties: schema.propertiesJSONSchema(),
+					Required:   schema.Required,
 				},
 			},
 		}
@@ -51,8 +132,18 @@ func (c *claudeProvider) Chat(ctx context.Context, params ChatParams) (*ChatResp
 			switch block.Type {
 			case "text":
 				blocks = append(blocks, anthropic.NewTextBlock(block.Text))
+			case "image":
+				blocks = append(blocks, anthropic.NewImageBlockBase64(block.MediaType, base64.StdEncoding.EncodeToString(block.ImageData)))
+			case "thinking":
+				blocks = append(blocks, anthropic.NewThinkingBlock(block.Signature, block.Thinking))
+			case "redacted_thinking":
+				blocks = append(blocks, anthropic.NewRedactedThinkingBlock(block.Data))
 			case "tool_use":
-				// Tool use blocks are part of assistant messages — handled via ToParam
+				input := block.ToolInput
+				if len(input) == 0 {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropic.NewToolUseBlock(block.ToolUseID, input, block.ToolName))
 			case "tool_result":
 				blocks = append(blocks, anthropic.NewToolResultBlock(block.ToolResultID, block.ToolResult, block.IsError))
 			}
@@ -65,25 +156,89 @@ func (c *claudeProvider) Chat(ctx context.Context, params ChatParams) (*ChatResp
 		}
 	}
 
-	resp, err := c.client.Messages.New(ctx, anthropic.MessageNewParams{
+	system := []anthropic.TextBlockParam{
+		{Text: params.System},
+	}
+	addCacheBreakpoints(system, tools, messages)
+
+	req := anthropic.MessageNewParams{
 		Model:     anthropic.Model(c.model),
 		MaxTokens: int64(maxTokens),
-		System: []anthropic.TextBlockParam{
-			{Text: params.System},
-		},
-		Messages: messages,
-		Tools:    tools,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("claude API error: %w", err)
+		System:    system,
+		Messages:  messages,
+		Tools:     tools,
+	}
+
+	switch params.ToolChoice.Mode {
+	case ToolChoiceAny:
+		req.ToolChoice = anthropic.ToolChoiceUnionParam{OfAny: &anthropic.ToolChoiceAnyParam{}}
+	case ToolChoiceNone:
+		req.ToolChoice = anthropic.ToolChoiceUnionParam{OfNone: &anthropic.ToolChoiceNoneParam{}}
+	case ToolChoiceTool:
+		req.ToolChoice = anthropic.ToolChoiceParamOfTool(params.ToolChoice.Name)
+	}
+	if params.SerialTools && len(tools) > 0 {
+		switch {
+		case req.ToolChoice.OfAny != nil:
+			req.ToolChoice.OfAny.DisableParallelToolUse = anthropic.Bool(true)
+		case req.ToolChoice.OfTool != nil:
+			req.ToolChoice.OfTool.DisableParallelToolUse = anthropic.Bool(true)
+		case req.ToolChoice.OfNone == nil:
+			req.ToolChoice = anthropic.ToolChoiceUnionParam{OfAuto: &anthropic.ToolChoiceAutoParam{DisableParallelToolUse: anthropic.Bool(true)}}
+		}
+	}
+
+	// Extended thinking cannot be combined with a forced tool call, so the
+	// forced choice wins for that request.
+	if budget := params.Reasoning.Budget(); budget > 0 && !params.ToolChoice.forced() {
+		// Thinking counts toward max_tokens, which the caller has already
+		// fitted to the model and the context window, so the budget shrinks
+		// to fit below it. The API requires at least 1024 thinking tokens;
+		// with less room than that, the request goes without thinking.
+		budget = min(max(budget, 1024), maxTokens-1)
+		if budget >= 1024 {
+			req.Thinking = anthropic.ThinkingConfigParamOfEnabled(int64(budget))
+		}
 	}
 
-	// Convert response
+	return req
+}
+
+// addCacheBreakpoints marks the system prompt, the tool list and the latest
+// message as prompt-cache breakpoints. Each turn only appends to the
+// conversation, so the next request reads everything up to the previous
+// turn's final message from the cache instead of paying for it again.
+func addCacheBreakpoints(system []anthropic.TextBlockParam, tools []anthropic.ToolUnionParam, messages []anthropic.MessageParam) {
+	if len(system) > 0 && system[0].Text != "" {
+		system[0].CacheControl = anthropic.NewCacheControlEphemeralParam()
+	}
+	if len(tools) > 0 {
+		if cc := tools[len(tools)-1].GetCacheControl(); cc != nil {
+			*cc = anthropic.NewCacheControlEphemeralParam()
+		}
+	}
+	if len(messages) > 0 {
+		blocks := messages[len(messages)-1].Content
+		for i := len(blocks) - 1; i >= 0; i-- {
+			if cc := blocks[i].GetCacheControl(); cc != nil {
+				*cc = anthropic.NewCacheControlEphemeralParam()
+				break
+			}
+		}
+	}
+}
+
+// convertClaudeResponse converts an Anthropic message into a ChatResponse.
+func convertClaudeResponse(resp *anthropic.Message) *ChatResponse {
 	var content []ContentBlock
 	for _, block := range resp.Content {
 		switch variant := block.AsAny().(type) {
 		case anthropic.TextBlock:
 			content = append(content, NewTextBlock(variant.Text))
+		case anthropic.ThinkingBlock:
+			content = append(content, NewThinkingBlock(variant.Thinking, variant.Signature))
+		case anthropic.RedactedThinkingBlock:
+			content = append(content, NewRedactedThinkingBlock(variant.Data))
 		case anthropic.ToolUseBlock:
 			inputRaw, _ := json.Marshal(variant.Input)
 			content = append(content, NewToolUseBlock(variant.ID, variant.Name, inputRaw))
@@ -91,11 +246,23 @@ func (c *claudeProvider) Chat(ctx context.Context, params ChatParams) (*ChatResp
 	}
 
 	stopReason := StopReasonEndTurn
-	if resp.StopReason == "tool_use" {
+	switch resp.StopReason {
+	case anthropic.StopReasonToolUse:
 		stopReason = StopReasonToolUse
-	} else if resp.StopReason == "max_tokens" {
+	case anthropic.StopReasonMaxTokens:
 		stopReason = StopReasonMaxTokens
+	case anthropic.StopReasonRefusal:
+		stopReason = StopReasonRefusal
+	case anthropic.StopReasonPauseTurn:
+		stopReason = StopReasonPauseTurn
+	}
+
+	usage := Usage{
+		InputTokens:      int(resp.Usage.InputTokens),
+		OutputTokens:     int(resp.Usage.OutputTokens),
+		CacheReadTokens:  int(resp.Usage.CacheReadInputTokens),
+		CacheWriteTokens: int(resp.Usage.CacheCreationInputTokens),
 	}
 
-	return &ChatResponse{Content: content, StopReason: stopReason}, nil
+	return &ChatResponse{Content: content, StopReason: stopReason, Usage: usage}
 }
@@ -0,0 +1,303 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	anthropicoption "github.com/anthropics/anthropic-sdk-go/option"
+)
+
+// claudeRequestJSON builds the Anthropic request for params and decodes it
+// back into generic JSON so tests can assert on the wire shape.
+func claudeRequestJSON(t *testing.T, params ChatParams) map[string]any {
+	t.Helper()
+	p := NewClaude("test-key", "").(*claudeProvider)
+	data, err := json.Marshal(p.buildRequest(params))
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+	var out map[string]any
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("unmarshal request: %v", err)
+	}
+	return out
+}
+
+func contentBlocks(t *testing.T, req map[string]any, msg int) []map[string]any {
+	t.Helper()
+	messages := req["messages"].([]any)
+	raw := messages[msg].(map[string]any)["content"].([]any)
+	blocks := make([]map[string]any, len(raw))
+	for i, b := range raw {
+		blocks[i] = b.(map[string]any)
+	}
+	return blocks
+}
+
+func TestClaudeRequestPreservesToolUse(t *testing.T) {
+	req := claudeRequestJSON(t, ChatParams{
+		System: "system",
+		Messages: []Message{
+			UserMessage(NewTextBlock("implement PROJ-1")),
+			AssistantMessage(
+				NewTextBlock("Reading both files."),
+				NewToolUseBlock("toolu_01", "read_file", json.RawMessage(`{"path":"a.go"}`)),
+				NewToolUseBlock("toolu_02", "read_file", json.RawMessage(`{"path":"b.go"}`)),
+			),
+			UserMessage(
+				NewToolResultBlock("toolu_01", "package a", false),
+				NewToolResultBlock("toolu_02", "no such file", true),
+			),
+			AssistantMessage(NewToolUseBlock("toolu_03", "list_directory", nil)),
+			UserMessage(NewToolResultBlock("toolu_03", "a.go", false)),
+		},
+	})
+
+	if got := len(req["messages"].([]any)); got != 5 {
+		t.Fatalf("got %d messages, want 5", got)
+	}
+
+	assistant := contentBlocks(t, req, 1)
+	if len(assistant) != 3 {
+		t.Fatalf("assistant message has %d blocks, want 3", len(assistant))
+	}
+	wantToolUse := map[string]any{
+		"type":  "tool_use",
+		"id":    "toolu_02",
+		"name":  "read_file",
+		"input": map[string]any{"path": "b.go"},
+	}
+	if !reflect.DeepEqual(assistant[2], wantToolUse) {
+		t.Errorf("tool_use block = %v, want %v", assistant[2], wantToolUse)
+	}
+
+	results := contentBlocks(t, req, 2)
+	for i, id := range []string{"toolu_01", "toolu_02"} {
+		if results[i]["type"] != "tool_result" || results[i]["tool_use_id"] != id {
+			t.Errorf("result %d = %v, want tool_result for %s", i, results[i], id)
+		}
+	}
+	if results[1]["is_error"] != true {
+		t.Errorf("result 1 is_error = %v, want true", results[1]["is_error"])
+	}
+
+	// A tool call without arguments still needs an input object.
+	noArgs := contentBlocks(t, req, 3)[0]
+	if !reflect.DeepEqual(noArgs["input"], map[string]any{}) {
+		t.Errorf("empty tool input = %v, want {}", noArgs["input"])
+	}
+}
+
+func TestClaudeRequestCacheBreakpoints(t *testing.T) {
+	req := claudeRequestJSON(t, ChatParams{
+		System: "system",
+		Tools: []Tool{
+			{Name: "read_file", Parameters: &Schema{Type: TypeObject}},
+			{Name: "write_file", Parameters: &Schema{Type: TypeObject}},
+		},
+		Messages: []Message{
+			UserMessage(NewTextBlock("first")),
+			AssistantMessage(NewToolUseBlock("toolu_01", "read_file", json.RawMessage(`{}`))),
+			UserMessage(NewToolResultBlock("toolu_01", "contents", false)),
+		},
+	})
+
+	ephemeral := map[string]any{"type": "ephemeral"}
+	system := req["system"].([]any)[0].(map[string]any)
+	if !reflect.DeepEqual(system["cache_control"], ephemeral) {
+		t.Errorf("system cache_control = %v", system["cache_control"])
+	}
+	tools := req["tools"].([]any)
+	if _, ok := tools[0].(map[string]any)["cache_control"]; ok {
+		t.Errorf("only the last tool should carry cache_control")
+	}
+	if !reflect.DeepEqual(tools[1].(map[string]any)["cache_control"], ephemeral) {
+		t.Errorf("last tool cache_control = %v", tools[1].(map[string]any)["cache_control"])
+	}
+	if _, ok := contentBlocks(t, req, 0)[0]["cache_control"]; ok {
+		t.Errorf("earlier messages should not carry cache_control")
+	}
+	if !reflect.DeepEqual(contentBlocks(t, req, 2)[0]["cache_control"], ephemeral) {
+		t.Errorf("latest message is missing cache_control")
+	}
+}
+
+func TestClaudeResponseConversion(t *testing.T) {
+	var msg anthropic.Message
+	err := json.Unmarshal([]byte(`{
+		"id": "msg_01", "type": "message", "role": "assistant", "model": "claude-sonnet-4-5",
+		"content": [
+			{"type": "text", "text": "Editing now."},
+			{"type": "tool_use", "id": "toolu_09", "name": "edit_file", "input": {"path": "a.go", "old_string": "x", "new_string": "y"}}
+		],
+		"stop_reason": "tool_use",
+		"usage": {"input_tokens": 12, "output_tokens": 34, "cache_read_input_tokens": 56, "cache_creation_input_tokens": 78}
+	}`), &msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := convertClaudeResponse(&msg)
+	if resp.StopReason != StopReasonToolUse {
+		t.Errorf("stop reason = %s, want %s", resp.StopReason, StopReasonToolUse)
+	}
+	if len(resp.Content) != 2 || resp.Content[0].Text != "Editing now." {
+		t.Fatalf("content = %+v", resp.Content)
+	}
+	call := resp.Content[1]
+	if call.ToolUseID != "toolu_09" || call.ToolName != "edit_file" {
+		t.Errorf("tool call = %+v", call)
+	}
+	var input map[string]string
+	if err := json.Unmarshal(call.ToolInput, &input); err != nil || input["new_string"] != "y" {
+		t.Errorf("tool input = %s (%v)", call.ToolInput, err)
+	}
+	want := Usage{InputTokens: 12, OutputTokens: 34, CacheReadTokens: 56, CacheWriteTokens: 78}
+	if resp.Usage != want {
+		t.Errorf("usage = %+v, want %+v", resp.Usage, want)
+	}
+}
+
+func TestClaudeRequestSerialTools(t *testing.T) {
+	tools := []Tool{{Name: "read_file"}}
+	tests := []struct {
+		choice ToolChoice
+		want   map[string]any
+	}{
+		{ToolChoice{}, map[string]any{"type": "auto", "disable_parallel_tool_use": true}},
+		{ToolChoice{Mode: ToolChoiceAny}, map[string]any{"type": "any", "disable_parallel_tool_use": true}},
+		{ToolChoice{Mode: ToolChoiceNone}, map[string]any{"type": "none"}},
+	}
+	for _, tt := range tests {
+		req := claudeRequestJSON(t, ChatParams{
+			Messages:    []Message{UserMessage(NewTextBlock("hi"))},
+			Tools:       tools,
+			ToolChoice:  tt.choice,
+			SerialTools: true,
+		})
+		if got, _ := req["tool_choice"].(map[string]any); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v: tool_choice = %v, want %v", tt.choice, got, tt.want)
+		}
+	}
+}
+
+func TestClaudeStreamTruncatedToolUse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeSSE(w, []string{
+			"message_start\n" + `{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-test","content":[],"stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":10,"output_tokens":1}}}`,
+			"content_block_start\n" + `{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"call_1","name":"write_file","input":{}}}`,
+			"content_block_delta\n" + `{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"path\":\"big.txt\",\"content\":\"lots of"}}`,
+			"content_block_stop\n" + `{"type":"content_block_stop","index":0}`,
+			"message_delta\n" + `{"type":"message_delta","delta":{"stop_reason":"max_tokens","stop_sequence":null},"usage":{"output_tokens":4096}}`,
+			"message_stop\n" + `{"type":"message_stop"}`,
+		})
+	}))
+	defer srv.Close()
+
+	client := anthropic.NewClient(anthropicoption.WithBaseURL(srv.URL), anthropicoption.WithAPIKey("test"), anthropicoption.WithMaxRetries(0))
+	p := &claudeProvider{client: &client, model: "claude-test"}
+	resp, err := p.ChatStream(context.Background(), ChatParams{Messages: []Message{UserMessage(NewTextBlock("write it"))}}, func(StreamEvent) {})
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+	if resp.StopReason != StopReasonMaxTokens {
+		t.Errorf("stop reason = %s, want %s", resp.StopReason, StopReasonMaxTokens)
+	}
+	if len(resp.Content) != 1 || resp.Content[0].ToolUseID != "call_1" || string(resp.Content[0].ToolInput) != `{"path":"big.txt","content":"lots of` {
+		t.Errorf("content = %+v, want the partial write_file call", resp.Content)
+	}
+}
+
+func TestClaudeRequestThinking(t *testing.T) {
+	req := claudeRequestJSON(t, ChatParams{
+		MaxTokens: 32768,
+		Reasoning: Reasoning{Effort: "high"},
+		Messages: []Message{
+			UserMessage(NewTextBlock("implement PROJ-1")),
+			AssistantMessage(
+				NewThinkingBlock("Need to read main.go first.", "sig-abc"),
+				NewRedactedThinkingBlock("opaque"),
+				NewToolUseBlock("toolu_01", "read_file", json.RawMessage(`{"path":"main.go"}`)),
+			),
+			UserMessage(NewToolResultBlock("toolu_01", "package main", false)),
+		},
+	})
+
+	wantThinking := map[string]any{"type": "enabled", "budget_tokens": float64(24576)}
+	if !reflect.DeepEqual(req["thinking"], wantThinking) {
+		t.Errorf("thinking = %v, want %v", req["thinking"], wantThinking)
+	}
+	if req["max_tokens"] != float64(32768) {
+		t.Errorf("max_tokens = %v, want the caller's limit", req["max_tokens"])
+	}
+
+	blocks := contentBlocks(t, req, 1)
+	wantBlocks := []map[string]any{
+		{"type": "thinking", "thinking": "Need to read main.go first.", "signature": "sig-abc"},
+		{"type": "redacted_thinking", "data": "opaque"},
+	}
+	for i, want := range wantBlocks {
+		if !reflect.DeepEqual(blocks[i], want) {
+			t.Errorf("block %d = %v, want %v", i, blocks[i], want)
+		}
+	}
+}
+
+func TestClaudeRequestThinkingFitsMaxTokens(t *testing.T) {
+	tests := []struct {
+		maxTokens  int
+		wantBudget any // nil if thinking is dropped
+	}{
+		{8192, float64(8191)},
+		{1024, nil},
+	}
+	for _, tt := range tests {
+		req := claudeRequestJSON(t, ChatParams{
+			MaxTokens: tt.maxTokens,
+			Reasoning: Reasoning{Effort: "high"},
+			Messages:  []Message{UserMessage(NewTextBlock("implement PROJ-1"))},
+		})
+		if req["max_tokens"] != float64(tt.maxTokens) {
+			t.Errorf("max_tokens %d: sent %v", tt.maxTokens, req["max_tokens"])
+		}
+		var budget any
+		if thinking, ok := req["thinking"].(map[string]any); ok {
+			budget = thinking["budget_tokens"]
+		}
+		if budget != tt.wantBudget {
+			t.Errorf("max_tokens %d: thinking budget = %v, want %v", tt.maxTokens, budget, tt.wantBudget)
+		}
+	}
+}
+
+func TestClaudeRequestToolChoice(t *testing.T) {
+	tests := []struct {
+		choice ToolChoice
+		want   map[string]any
+	}{
+		{ToolChoice{}, nil},
+		{ToolChoice{Mode: ToolChoiceAny}, map[string]any{"type": "any"}},
+		{ToolChoice{Mode: ToolChoiceNone}, map[string]any{"type": "none"}},
+		{ForceTool("finish"), map[string]any{"type": "tool", "name": "finish"}},
+	}
+	for _, tt := range tests {
+		req := claudeRequestJSON(t, ChatParams{
+			Messages:   []Message{UserMessage(NewTextBlock("hi"))},
+			Reasoning:  Reasoning{Effort: "low"},
+			ToolChoice: tt.choice,
+		})
+		got, _ := req["tool_choice"].(map[string]any)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v: tool_choice = %v, want %v", tt.choice, got, tt.want)
+		}
+		// Forcing a tool call is incompatible with extended thinking.
+		if _, thinking := req["thinking"]; thinking == tt.choice.forced() {
+			t.Errorf("%+v: thinking present = %v", tt.choice, thinking)
+		}
+	}
+}
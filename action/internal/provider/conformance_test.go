@@ -0,0 +1,599 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	anthropicoption "github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"google.golang.org/genai"
+)
+
+// The conformance suite sends the same conversation through every provider
+// against a local stand-in for its API. It checks that each request carries
+// the conversation in the vendor's wire format, and that each vendor's
+// response (plain and streamed) decodes to the same ChatResponse.
+
+var conformanceImage = []byte("\x89PNG\r\n\x1a\nnot really a png")
+
+var conformanceParams = ChatParams{
+	System: "You are a careful engineer.",
+	Messages: []Message{
+		{Role: RoleUser, Content: []ContentBlock{
+			NewTextBlock("Fix the crash shown in the screenshot."),
+			NewImageBlock(conformanceImage, "image/png"),
+		}},
+		{Role: RoleAssistant, Content: []ContentBlock{
+			NewTextBlock("Let me look at the code."),
+			NewTextBlock("Reading two places at once."),
+			NewToolUseBlock("call_a", "read_file", json.RawMessage(`{"path":"a.go"}`)),
+			NewToolUseBlock("call_b", "search_code", json.RawMessage(`{"pattern":"TODO"}`)),
+		}},
+		{Role: RoleUser, Content: []ContentBlock{
+			NewToolResultBlock("call_a", "package a", false),
+			NewToolResultBlock("call_b", "no matches", true),
+			NewTextBlock("Note: half of the turn budget is used."),
+		}},
+	},
+	Tools: []Tool{
+		{Name: "read_file", Description: "Read a file", Parameters: &Schema{
+			Type:       TypeObject,
+			Properties: map[string]*Schema{"path": {Type: TypeString}},
+			Required:   []string{"path"},
+		}},
+		{Name: "search_code", Description: "Search the repository", Parameters: &Schema{
+			Type:       TypeObject,
+			Properties: map[string]*Schema{"pattern": {Type: TypeString}},
+			Required:   []string{"pattern"},
+		}},
+		{Name: "list_changes", Description: "List the files changed so far"},
+	},
+	MaxTokens: 4096,
+}
+
+// wireItem is one piece of a request's conversation, normalized across
+// vendors. Adjacent text from the same message is merged, since some
+// vendors carry several text blocks and others a single string.
+type wireItem struct {
+	Role    string // "user" or "assistant"
+	Kind    string // "text", "image", "tool_use" or "tool_result"
+	ID      string // tool call ID
+	Name    string // tool name
+	Text    string // text, image data URL, tool input JSON or tool result
+	IsError bool
+}
+
+// wireRequest is a vendor request reduced to what the suite compares.
+type wireRequest struct {
+	System    string
+	Tools     []string
+	MaxTokens int
+	Items     []wireItem
+}
+
+func conformanceWant(errorFlag bool) wireRequest {
+	return wireRequest{
+		System:    "You are a careful engineer.",
+		Tools:     []string{"read_file", "search_code", "list_changes"},
+		MaxTokens: 4096,
+		Items: []wireItem{
+			{Role: "user", Kind: "text", Text: "Fix the crash shown in the screenshot."},
+			{Role: "user", Kind: "image", Text: "data:image/png;base64," + base64.StdEncoding.EncodeToString(conformanceImage)},
+			{Role: "assistant", Kind: "text", Text: "Let me look at the code.\n\nReading two places at once."},
+			{Role: "assistant", Kind: "tool_use", ID: "call_a", Name: "read_file", Text: `{"path":"a.go"}`},
+			{Role: "assistant", Kind: "tool_use", ID: "call_b", Name: "search_code", Text: `{"pattern":"TODO"}`},
+			{Role: "user", Kind: "tool_result", ID: "call_a", Text: "package a"},
+			{Role: "user", Kind: "tool_result", ID: "call_b", Text: "no matches", IsError: errorFlag},
+			{Role: "user", Kind: "text", Text: "Note: half of the turn budget is used."},
+		},
+	}
+}
+
+// conformanceResponse is what every vendor's canned response decodes to.
+var conformanceResponse = &ChatResponse{
+	Content: []ContentBlock{
+		NewTextBlock("Both files look fine."),
+		NewToolUseBlock("call_c", "read_file", json.RawMessage(`{"path":"b.go"}`)),
+		NewToolUseBlock("call_d", "list_directory", json.RawMessage(`{"path":"."}`)),
+	},
+	StopReason: StopReasonToolUse,
+	Usage:      Usage{InputTokens: 90, OutputTokens: 20, CacheReadTokens: 10},
+}
+
+type vendor struct {
+	name string
+	// errorFlag is whether the wire format can mark a tool result as failed.
+	errorFlag bool
+	// newProvider builds the provider against the stand-in server.
+	newProvider func(t *testing.T, baseURL string) Provider
+	// normalize reduces a captured request body to a wireRequest.
+	normalize func(t *testing.T, body map[string]any) wireRequest
+	// respond writes the canned response, streamed if the request asks for it.
+	respond func(w http.ResponseWriter, r *http.Request, body map[string]any)
+}
+
+var vendors = []vendor{
+	{
+		name:      "claude",
+		errorFlag: true,
+		newProvider: func(t *testing.T, baseURL string) Provider {
+			client := anthropic.NewClient(anthropicoption.WithBaseURL(baseURL), anthropicoption.WithAPIKey("test"), anthropicoption.WithMaxRetries(0))
+			return &claudeProvider{client: &client, model: "claude-test"}
+		},
+		normalize: normalizeClaude,
+		respond: func(w http.ResponseWriter, r *http.Request, body map[string]any) {
+			if body["stream"] == true {
+				writeSSE(w, claudeStream)
+				return
+			}
+			writeJSON(w, claudeMessage)
+		},
+	},
+	{
+		name: "openai",
+		newProvider: func(t *testing.T, baseURL string) Provider {
+			client := openai.NewClient(option.WithBaseURL(baseURL), option.WithAPIKey("test"), option.WithMaxRetries(0))
+			return &openaiProvider{client: &client, model: "gpt-test"}
+		},
+		normalize: normalizeOpenAI,
+		respond: func(w http.ResponseWriter, r *http.Request, body map[string]any) {
+			if body["stream"] == true {
+				writeSSE(w, openaiStream)
+				return
+			}
+			writeJSON(w, openaiCompletion)
+		},
+	},
+	{
+		name: "openai-responses",
+		newProvider: func(t *testing.T, baseURL string) Provider {
+			client := openai.NewClient(option.WithBaseURL(baseURL), option.WithAPIKey("test"), option.WithMaxRetries(0))
+			return &openaiResponsesProvider{client: &client, model: "gpt-test"}
+		},
+		normalize: normalizeResponses,
+		respond: func(w http.ResponseWriter, r *http.Request, body map[string]any) {
+			if body["stream"] == true {
+				writeSSE(w, responsesStream)
+				return
+			}
+			writeJSON(w, responsesResponse)
+		},
+	},
+	{
+		name:      "gemini",
+		errorFlag: true,
+		newProvider: func(t *testing.T, baseURL string) Provider {
+			client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+				APIKey:      "test",
+				Backend:     genai.BackendGeminiAPI,
+				HTTPOptions: genai.HTTPOptions{BaseURL: baseURL},
+			})
+			if err != nil {
+				t.Fatalf("gemini client: %v", err)
+			}
+			return &geminiProvider{client: client, model: "gemini-test"}
+		},
+		normalize: normalizeGemini,
+		respond: func(w http.ResponseWriter, r *http.Request, body map[string]any) {
+			if strings.Contains(r.URL.Path, ":streamGenerateContent") {
+				writeSSE(w, geminiStream)
+				return
+			}
+			writeJSON(w, geminiResponse)
+		},
+	},
+}
+
+func TestProviderConformance(t *testing.T) {
+	for _, v := range vendors {
+		for _, stream := range []bool{false, true} {
+			name := v.name
+			if stream {
+				name += "/stream"
+			}
+			t.Run(name, func(t *testing.T) {
+				var mu sync.Mutex
+				var bodies []map[string]any
+				srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					data, err := io.ReadAll(r.Body)
+					if err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+					var body map[string]any
+					if err := json.Unmarshal(data, &body); err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+					mu.Lock()
+					bodies = append(bodies, body)
+					mu.Unlock()
+					v.respond(w, r, body)
+				}))
+				defer srv.Close()
+
+				p := v.newProvider(t, srv.URL+"/")
+				var resp *ChatResponse
+				var err error
+				var text strings.Builder
+				var started []string
+				if stream {
+					resp, err = p.ChatStream(context.Background(), conformanceParams, func(ev StreamEvent) {
+						switch ev.Type {
+						case StreamEventTextDelta:
+							text.WriteString(ev.Text)
+						case StreamEventToolUseStart:
+							started = append(started, ev.ToolUseID)
+						}
+					})
+				} else {
+					resp, err = p.Chat(context.Background(), conformanceParams)
+				}
+				if err != nil {
+					t.Fatalf("request failed: %v", err)
+				}
+
+				if len(bodies) != 1 {
+					t.Fatalf("server saw %d requests, want 1", len(bodies))
+				}
+				got := v.normalize(t, bodies[0])
+				if want := conformanceWant(v.errorFlag); !reflect.DeepEqual(got, want) {
+					t.Errorf("request mismatch\n got: %+v\nwant: %+v", got, want)
+				}
+
+				assertConformanceResponse(t, resp)
+				if stream {
+					if text.String() != "Both files look fine." {
+						t.Errorf("streamed text = %q", text.String())
+					}
+					if want := []string{"call_c", "call_d"}; !reflect.DeepEqual(started, want) {
+						t.Errorf("tool starts = %v, want %v", started, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func assertConformanceResponse(t *testing.T, got *ChatResponse) {
+	t.Helper()
+	want := conformanceResponse
+	if got.StopReason != want.StopReason {
+		t.Errorf("stop reason = %q, want %q", got.StopReason, want.StopReason)
+	}
+	if got.Usage != want.Usage {
+		t.Errorf("usage = %+v, want %+v", got.Usage, want.Usage)
+	}
+	if len(got.Content) != len(want.Content) {
+		t.Fatalf("got %d content blocks, want %d: %+v", len(got.Content), len(want.Content), got.Content)
+	}
+	for i, w := range want.Content {
+		g := got.Content[i]
+		if g.Type != w.Type || g.Text != w.Text || g.ToolUseID != w.ToolUseID || g.ToolName != w.ToolName {
+			t.Errorf("block %d = %+v, want %+v", i, g, w)
+		}
+		if w.Type == "tool_use" && compactJSON(t, g.ToolInput) != compactJSON(t, w.ToolInput) {
+			t.Errorf("block %d input = %s, want %s", i, g.ToolInput, w.ToolInput)
+		}
+	}
+}
+
+// compactJSON re-encodes a JSON value so equivalent inputs compare equal
+// regardless of spacing or key order.
+func compactJSON(t *testing.T, data any) string {
+	t.Helper()
+	var raw []byte
+	switch d := data.(type) {
+	case string:
+		raw = []byte(d)
+	case json.RawMessage:
+		raw = d
+	default:
+		var err error
+		if raw, err = json.Marshal(d); err != nil {
+			t.Fatalf("marshal %v: %v", d, err)
+		}
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		t.Fatalf("invalid JSON %s: %v", raw, err)
+	}
+	out, _ := json.Marshal(v)
+	return string(out)
+}
+
+// appendItem adds an item, merging text into a preceding text item from the
+// same message.
+func appendItem(items []wireItem, item wireItem, sameMessage bool) []wireItem {
+	if n := len(items); sameMessage && n > 0 && item.Kind == "text" && items[n-1].Kind == "text" && items[n-1].Role == item.Role {
+		items[n-1].Text += "\n\n" + item.Text
+		return items
+	}
+	return append(items, item)
+}
+
+func list(v any) []map[string]any {
+	raw, _ := v.([]any)
+	out := make([]map[string]any, len(raw))
+	for i, x := range raw {
+		out[i], _ = x.(map[string]any)
+	}
+	return out
+}
+
+func str(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+func number(v any) int {
+	f, _ := v.(float64)
+	return int(f)
+}
+
+func normalizeClaude(t *testing.T, body map[string]any) wireRequest {
+	req := wireRequest{MaxTokens: number(body["max_tokens"])}
+	for _, block := range list(body["system"]) {
+		req.System += str(block["text"])
+	}
+	for _, tool := range list(body["tools"]) {
+		req.Tools = append(req.Tools, str(tool["name"]))
+	}
+	for _, msg := range list(body["messages"]) {
+		role := str(msg["role"])
+		for i, block := range list(msg["content"]) {
+			item := wireItem{Role: role, Kind: str(block["type"])}
+			switch item.Kind {
+			case "text":
+				item.Text = str(block["text"])
+			case "image":
+				source := block["source"].(map[string]any)
+				item.Text = "data:" + str(source["media_type"]) + ";base64," + str(source["data"])
+			case "tool_use":
+				item.ID, item.Name = str(block["id"]), str(block["name"])
+				item.Text = compactJSON(t, block["input"])
+			case "tool_result":
+				item.ID = str(block["tool_use_id"])
+				item.IsError = block["is_error"] == true
+				if s, ok := block["content"].(string); ok {
+					item.Text = s
+				}
+				for _, part := range list(block["content"]) {
+					item.Text += str(part["text"])
+				}
+			}
+			req.Items = appendItem(req.Items, item, i > 0)
+		}
+	}
+	return req
+}
+
+func normalizeOpenAI(t *testing.T, body map[string]any) wireRequest {
+	req := wireRequest{MaxTokens: number(body["max_completion_tokens"])}
+	for _, tool := range list(body["tools"]) {
+		req.Tools = append(req.Tools, str(tool["function"].(map[string]any)["name"]))
+	}
+	for _, msg := range list(body["messages"]) {
+		role := str(msg["role"])
+		switch role {
+		case "system":
+			req.System = str(msg["content"])
+		case "tool":
+			req.Items = append(req.Items, wireItem{Role: "user", Kind: "tool_result", ID: str(msg["tool_call_id"]), Text: str(msg["content"])})
+		default:
+			if s, ok := msg["content"].(string); ok {
+				req.Items = append(req.Items, wireItem{Role: role, Kind: "text", Text: s})
+			}
+			for i, part := range list(msg["content"]) {
+				switch str(part["type"]) {
+				case "text":
+					req.Items = appendItem(req.Items, wireItem{Role: role, Kind: "text", Text: str(part["text"])}, i > 0)
+				case "image_url":
+					req.Items = append(req.Items, wireItem{Role: role, Kind: "image", Text: str(part["image_url"].(map[string]any)["url"])})
+				}
+			}
+			for _, call := range list(msg["tool_calls"]) {
+				fn := call["function"].(map[string]any)
+				req.Items = append(req.Items, wireItem{Role: role, Kind: "tool_use", ID: str(call["id"]), Name: str(fn["name"]), Text: compactJSON(t, str(fn["arguments"]))})
+			}
+		}
+	}
+	return req
+}
+
+func normalizeResponses(t *testing.T, body map[string]any) wireRequest {
+	req := wireRequest{System: str(body["instructions"]), MaxTokens: number(body["max_output_tokens"])}
+	for _, tool := range list(body["tools"]) {
+		req.Tools = append(req.Tools, str(tool["name"]))
+	}
+	var prevAssistantText bool
+	for _, item := range list(body["input"]) {
+		switch str(item["type"]) {
+		case "function_call":
+			req.Items = append(req.Items, wireItem{Role: "assistant", Kind: "tool_use", ID: str(item["call_id"]), Name: str(item["name"]), Text: compactJSON(t, str(item["arguments"]))})
+		case "function_call_output":
+			req.Items = append(req.Items, wireItem{Role: "user", Kind: "tool_result", ID: str(item["call_id"]), Text: str(item["output"])})
+		default: // messages
+			role := str(item["role"])
+			if s, ok := item["content"].(string); ok {
+				// Assistant text blocks are separate input messages.
+				req.Items = appendItem(req.Items, wireItem{Role: role, Kind: "text", Text: s}, role == "assistant" && prevAssistantText)
+			}
+			for i, part := range list(item["content"]) {
+				switch str(part["type"]) {
+				case "input_text", "output_text":
+					req.Items = appendItem(req.Items, wireItem{Role: role, Kind: "text", Text: str(part["text"])}, i > 0)
+				case "input_image":
+					req.Items = append(req.Items, wireItem{Role: role, Kind: "image", Text: str(part["image_url"])})
+				}
+			}
+		}
+		n := len(req.Items)
+		prevAssistantText = n > 0 && req.Items[n-1].Role == "assistant" && req.Items[n-1].Kind == "text"
+	}
+	return req
+}
+
+func normalizeGemini(t *testing.T, body map[string]any) wireRequest {
+	var req wireRequest
+	if config, ok := body["generationConfig"].(map[string]any); ok {
+		req.MaxTokens = number(config["maxOutputTokens"])
+	}
+	if system, ok := body["systemInstruction"].(map[string]any); ok {
+		for _, part := range list(system["parts"]) {
+			req.System += str(part["text"])
+		}
+	}
+	for _, tool := range list(body["tools"]) {
+		for _, decl := range list(tool["functionDeclarations"]) {
+			req.Tools = append(req.Tools, str(decl["name"]))
+		}
+	}
+	for _, content := range list(body["contents"]) {
+		role := "user"
+		if str(content["role"]) == "model" {
+			role = "assistant"
+		}
+		for i, part := range list(content["parts"]) {
+			switch {
+			case part["text"] != nil:
+				req.Items = appendItem(req.Items, wireItem{Role: role, Kind: "text", Text: str(part["text"])}, i > 0)
+			case part["inlineData"] != nil:
+				blob := part["inlineData"].(map[string]any)
+				req.Items = append(req.Items, wireItem{Role: role, Kind: "image", Text: "data:" + str(blob["mimeType"]) + ";base64," + str(blob["data"])})
+			case part["functionCall"] != nil:
+				call := part["functionCall"].(map[string]any)
+				req.Items = append(req.Items, wireItem{Role: role, Kind: "tool_use", ID: str(call["id"]), Name: str(call["name"]), Text: compactJSON(t, call["args"])})
+			case part["functionResponse"] != nil:
+				fr := part["functionResponse"].(map[string]any)
+				response := fr["response"].(map[string]any)
+				req.Items = append(req.Items, wireItem{Role: role, Kind: "tool_result", ID: str(fr["id"]), Text: str(response["result"]), IsError: response["error"] == true})
+			}
+		}
+	}
+	return req
+}
+
+func writeJSON(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, body)
+}
+
+// writeSSE writes events as a server-sent event stream. An event given as
+// "name\ndata" is sent with an event field; otherwise only data is sent.
+func writeSSE(w http.ResponseWriter, events []string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, ev := range events {
+		if name, data, ok := strings.Cut(ev, "\n"); ok {
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+		} else {
+			fmt.Fprintf(w, "data: %s\n\n", ev)
+		}
+	}
+}
+
+const claudeMessage = `{
+  "id": "msg_1", "type": "message", "role": "assistant", "model": "claude-test",
+  "content": [
+    {"type": "text", "text": "Both files look fine."},
+    {"type": "tool_use", "id": "call_c", "name": "read_file", "input": {"path": "b.go"}},
+    {"type": "tool_use", "id": "call_d", "name": "list_directory", "input": {"path": "."}}
+  ],
+  "stop_reason": "tool_use", "stop_sequence": null,
+  "usage": {"input_tokens": 90, "output_tokens": 20, "cache_read_input_tokens": 10, "cache_creation_input_tokens": 0}
+}`
+
+var claudeStream = []string{
+	"message_start\n" + `{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-test","content":[],"stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":90,"output_tokens":1,"cache_read_input_tokens":10,"cache_creation_input_tokens":0}}}`,
+	"content_block_start\n" + `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+	"content_block_delta\n" + `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Both files "}}`,
+	"content_block_delta\n" + `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"look fine."}}`,
+	"content_block_stop\n" + `{"type":"content_block_stop","index":0}`,
+	"content_block_start\n" + `{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"call_c","name":"read_file","input":{}}}`,
+	"content_block_delta\n" + `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"path\":"}}`,
+	"content_block_delta\n" + `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"b.go\"}"}}`,
+	"content_block_stop\n" + `{"type":"content_block_stop","index":1}`,
+	"content_block_start\n" + `{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"call_d","name":"list_directory","input":{}}}`,
+	"content_block_delta\n" + `{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"path\":\".\"}"}}`,
+	"content_block_stop\n" + `{"type":"content_block_stop","index":2}`,
+	"message_delta\n" + `{"type":"message_delta","delta":{"stop_reason":"tool_use","stop_sequence":null},"usage":{"output_tokens":20}}`,
+	"message_stop\n" + `{"type":"message_stop"}`,
+}
+
+const openaiCompletion = `{
+  "id": "chatcmpl-1", "object": "chat.completion", "created": 1, "model": "gpt-test",
+  "choices": [{
+    "index": 0, "finish_reason": "tool_calls", "logprobs": null,
+    "message": {
+      "role": "assistant", "content": "Both files look fine.", "refusal": null,
+      "tool_calls": [
+        {"id": "call_c", "type": "function", "function": {"name": "read_file", "arguments": "{\"path\":\"b.go\"}"}},
+        {"id": "call_d", "type": "function", "function": {"name": "list_directory", "arguments": "{\"path\":\".\"}"}}
+      ]
+    }
+  }],
+  "usage": {"prompt_tokens": 100, "completion_tokens": 20, "total_tokens": 120, "prompt_tokens_details": {"cached_tokens": 10}}
+}`
+
+var openaiStream = []string{
+	`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-test","choices":[{"index":0,"delta":{"role":"assistant","content":"Both files "},"finish_reason":null}]}`,
+	`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-test","choices":[{"index":0,"delta":{"content":"look fine."},"finish_reason":null}]}`,
+	`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-test","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_c","type":"function","function":{"name":"read_file","arguments":""}}]},"finish_reason":null}]}`,
+	`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-test","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"path\":\"b.go\"}"}}]},"finish_reason":null}]}`,
+	`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-test","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_d","type":"function","function":{"name":"list_directory","arguments":"{\"path\":\".\"}"}}]},"finish_reason":null}]}`,
+	`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-test","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+	`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-test","choices":[],"usage":{"prompt_tokens":100,"completion_tokens":20,"total_tokens":120,"prompt_tokens_details":{"cached_tokens":10}}}`,
+	`[DONE]`,
+}
+
+const responsesResponse = `{
+  "id": "resp_1", "object": "response", "created_at": 1, "status": "completed", "model": "gpt-test",
+  "output": [
+    {"type": "message", "id": "msg_1", "role": "assistant", "status": "completed",
+     "content": [{"type": "output_text", "text": "Both files look fine.", "annotations": []}]},
+    {"type": "function_call", "id": "fc_c", "call_id": "call_c", "name": "read_file", "arguments": "{\"path\":\"b.go\"}", "status": "completed"},
+    {"type": "function_call", "id": "fc_d", "call_id": "call_d", "name": "list_directory", "arguments": "{\"path\":\".\"}", "status": "completed"}
+  ],
+  "usage": {"input_tokens": 100, "input_tokens_details": {"cached_tokens": 10}, "output_tokens": 20, "output_tokens_details": {"reasoning_tokens": 0}, "total_tokens": 120},
+  "parallel_tool_calls": true, "tool_choice": "auto", "tools": [], "error": null, "incomplete_details": null
+}`
+
+var responsesStream = []string{
+	"response.output_item.added\n" + `{"type":"response.output_item.added","output_index":0,"item":{"type":"message","id":"msg_1","role":"assistant","status":"in_progress","content":[]}}`,
+	"response.output_text.delta\n" + `{"type":"response.output_text.delta","item_id":"msg_1","output_index":0,"content_index":0,"delta":"Both files "}`,
+	"response.output_text.delta\n" + `{"type":"response.output_text.delta","item_id":"msg_1","output_index":0,"content_index":0,"delta":"look fine."}`,
+	"response.output_item.added\n" + `{"type":"response.output_item.added","output_index":1,"item":{"type":"function_call","id":"fc_c","call_id":"call_c","name":"read_file","arguments":"","status":"in_progress"}}`,
+	"response.function_call_arguments.delta\n" + `{"type":"response.function_call_arguments.delta","item_id":"fc_c","output_index":1,"delta":"{\"path\":\"b.go\"}"}`,
+	"response.output_item.added\n" + `{"type":"response.output_item.added","output_index":2,"item":{"type":"function_call","id":"fc_d","call_id":"call_d","name":"list_directory","arguments":"","status":"in_progress"}}`,
+	"response.function_call_arguments.delta\n" + `{"type":"response.function_call_arguments.delta","item_id":"fc_d","output_index":2,"delta":"{\"path\":\".\"}"}`,
+	"response.completed\n" + `{"type":"response.completed","response":` + strings.Join(strings.Fields(responsesResponse), " ") + `}`,
+}
+
+const geminiResponse = `{
+  "candidates": [{
+    "content": {"role": "model", "parts": [
+      {"text": "Both files look fine."},
+      {"functionCall": {"id": "call_c", "name": "read_file", "args": {"path": "b.go"}}},
+      {"functionCall": {"id": "call_d", "name": "list_directory", "args": {"path": "."}}}
+    ]},
+    "finishReason": "STOP"
+  }],
+  "usageMetadata": {"promptTokenCount": 100, "cachedContentTokenCount": 10, "candidatesTokenCount": 20}
+}`
+
+var geminiStream = []string{
+	`{"candidates":[{"content":{"role":"model","parts":[{"text":"Both files "}]}}]}`,
+	`{"candidates":[{"content":{"role":"model","parts":[{"text":"look fine."}]}}]}`,
+	`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"id":"call_c","name":"read_file","args":{"path":"b.go"}}},{"functionCall":{"id":"call_d","name":"list_directory","args":{"path":"."}}}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":100,"cachedContentTokenCount":10,"candidatesTokenCount":20}}`,
+}
@@ -0,0 +1,172 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/openai/openai-go"
+	"google.golang.org/genai"
+)
+
+// Sentinel error kinds. Provider errors wrap one of these when the failure
+// could be classified, so callers can test for them with errors.Is.
+var (
+	ErrRateLimited     = errors.New("rate limited")
+	ErrQuotaExceeded   = errors.New("quota exceeded")
+	ErrAuth            = errors.New("authentication failed")
+	ErrContextOverflow = errors.New("context window exceeded")
+	ErrContentFiltered = errors.New("content filtered")
+	ErrServer          = errors.New("server error")
+)
+
+// APIError is a failed provider request. It unwraps to both the error kind
+// (one of the Err sentinels, if known) and the underlying SDK error.
+type APIError struct {
+	Provider   string // "claude", "openai" or "gemini"
+	Kind       error  // nil if the failure could not be classified
+	StatusCode int    // HTTP status, 0 if there was no response
+	Err        error
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s API error: %v", e.Provider, e.Err)
+}
+
+func (e *APIError) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// wrapAPIError classifies an SDK error from the named provider.
+func wrapAPIError(providerName string, err error) error {
+	apiErr := &APIError{Provider: providerName, Err: err}
+
+	var claudeErr *anthropic.Error
+	var openaiErr *openai.Error
+	var geminiErr genai.APIError
+	switch {
+	case errors.As(err, &claudeErr):
+		apiErr.StatusCode = claudeErr.StatusCode
+		apiErr.Kind = classifyStatus(claudeErr.StatusCode, claudeErr.Error())
+	case errors.As(err, &openaiErr):
+		apiErr.StatusCode = openaiErr.StatusCode
+		apiErr.Kind = classifyCode(openaiErr.Code)
+		if apiErr.Kind == nil {
+			apiErr.Kind = classifyStatus(openaiErr.StatusCode, openaiErr.Message)
+		}
+	case errors.As(err, &geminiErr):
+		apiErr.StatusCode = geminiErr.Code
+		apiErr.Kind = classifyStatus(geminiErr.Code, geminiErr.Message)
+	default:
+		if code := streamErrorCode(err); code != "" {
+			apiErr.Kind = classifyCode(code)
+			if apiErr.Kind == nil && isContextOverflowMessage(err.Error()) {
+				apiErr.Kind = ErrContextOverflow
+			}
+		}
+	}
+	return apiErr
+}
+
+// newAPIError builds an error for a failure reported in-band (for example
+// a stream event) rather than as an HTTP error, classified by its code.
+func newAPIError(providerName, code, message string) error {
+	return &APIError{
+		Provider: providerName,
+		Kind:     classifyCode(code),
+		Err:      fmt.Errorf("%s: %s", code, message),
+	}
+}
+
+// classifyStatus maps an HTTP status and error message to an error kind.
+func classifyStatus(status int, message string) error {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrAuth
+	case status == http.StatusBadRequest || status == http.StatusRequestEntityTooLarge:
+		if isContextOverflowMessage(message) {
+			return ErrContextOverflow
+		}
+		return nil
+	case status >= 500:
+		return ErrServer
+	}
+	return nil
+}
+
+// classifyCode maps an OpenAI-style error code or an Anthropic error type
+// to an error kind.
+func classifyCode(code string) error {
+	switch code {
+	case "rate_limit_exceeded", "rate_limit_error":
+		return ErrRateLimited
+	case "insufficient_quota", "billing_error":
+		return ErrQuotaExceeded
+	case "invalid_api_key", "authentication_error", "permission_error":
+		return ErrAuth
+	case "context_length_exceeded":
+		return ErrContextOverflow
+	case "content_filter", "content_policy_violation":
+		return ErrContentFiltered
+	case "server_error", "api_error", "overloaded_error":
+		return ErrServer
+	}
+	return nil
+}
+
+// streamErrorPrefix starts the error the Anthropic and OpenAI SDKs return
+// for an error event received mid-stream; the event's payload follows.
+const streamErrorPrefix = "received error while streaming: "
+
+// streamErrorCode returns the type or code of an error event received
+// mid-stream, or "" if err is not one. Anthropic sends
+// {"type": "error", "error": {"type": ...}}, OpenAI the error object itself.
+func streamErrorCode(err error) string {
+	_, payload, ok := strings.Cut(err.Error(), streamErrorPrefix)
+	if !ok {
+		return ""
+	}
+	var event struct {
+		Type  string `json:"type"`
+		Code  string `json:"code"`
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if json.Unmarshal([]byte(payload), &event) != nil {
+		return ""
+	}
+	switch {
+	case event.Error.Type != "":
+		return event.Error.Type
+	case event.Code != "":
+		return event.Code
+	}
+	return event.Type
+}
+
+// isContextOverflowMessage recognizes each vendor's wording for a prompt
+// that does not fit the model's context window.
+func isContextOverflowMessage(message string) bool {
+	message = strings.ToLower(message)
+	for _, phrase := range []string{
+		"prompt is too long",                   // Anthropic
+		"context length",                       // OpenAI
+		"maximum context",                      // OpenAI-compatible servers
+		"exceeds the maximum number of tokens", // Gemini
+		"input token count",                    // Gemini
+	} {
+		if strings.Contains(message, phrase) {
+			return true
+		}
+	}
+	return false
+}
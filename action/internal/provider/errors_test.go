@@ -0,0 +1,46 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"google.golang.org/genai"
+)
+
+func TestWrapAPIError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"openai rate limit", &openai.Error{StatusCode: 429, Code: "rate_limit_exceeded"}, ErrRateLimited},
+		{"openai context", &openai.Error{StatusCode: 400, Code: "context_length_exceeded"}, ErrContextOverflow},
+		{"openai filter", &openai.Error{StatusCode: 400, Code: "content_filter"}, ErrContentFiltered},
+		{"openai auth", &openai.Error{StatusCode: 401}, ErrAuth},
+		{"openai quota", &openai.Error{StatusCode: 429, Code: "insufficient_quota"}, ErrQuotaExceeded},
+		{"claude stream overload", fmt.Errorf("%s%s", streamErrorPrefix, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`), ErrServer},
+		{"claude stream overflow", fmt.Errorf("%s%s", streamErrorPrefix, `{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long: 210000 tokens > 200000 maximum"}}`), ErrContextOverflow},
+		{"openai stream rate limit", fmt.Errorf("%s%s", streamErrorPrefix, `{"message":"slow down","type":"requests","code":"rate_limit_exceeded"}`), ErrRateLimited},
+		{"gemini overflow", genai.APIError{Code: 400, Message: "The input token count (1200000) exceeds the maximum number of tokens allowed (1048576)."}, ErrContextOverflow},
+		{"gemini server", genai.APIError{Code: 503, Message: "overloaded"}, ErrServer},
+		{"gemini bad request", genai.APIError{Code: 400, Message: "invalid argument"}, nil},
+		{"network", errors.New("connection reset"), nil},
+	}
+	kinds := []error{ErrRateLimited, ErrQuotaExceeded, ErrAuth, ErrContextOverflow, ErrContentFiltered, ErrServer}
+
+	for _, tt := range tests {
+		err := wrapAPIError("test", tt.err)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || !reflect.DeepEqual(apiErr.Err, tt.err) {
+			t.Errorf("%s: wrapped error does not carry the original", tt.name)
+		}
+		for _, kind := range kinds {
+			if got := errors.Is(err, kind); got != (kind == tt.want) {
+				t.Errorf("%s: errors.Is(err, %v) = %v", tt.name, kind, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Package fake provides a scriptable provider.Provider for unit tests. A test
+// lists the responses the model should give, in order, and optionally checks
+// each request the code under test sends.
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/AkshayNayak/ticketflow/action/internal/provider"
+)
+
+// Step is one scripted exchange: the response (or error) returned for the
+// next request, plus optional checks on that request.
+type Step struct {
+	Response *provider.ChatResponse
+	Err      error
+	checks   []func(testing.TB, provider.ChatParams)
+}
+
+// Text scripts a final answer that ends the turn.
+func Text(text string) Step {
+	return Respond(provider.StopReasonEndTurn, provider.NewTextBlock(text))
+}
+
+// ToolCalls scripts a response that requests the given tool calls.
+func ToolCalls(calls ...provider.ContentBlock) Step {
+	return Respond(provider.StopReasonToolUse, calls...)
+}
+
+// Respond scripts a response with arbitrary content and stop reason.
+func Respond(stop provider.StopReason, content ...provider.ContentBlock) Step {
+	return Step{Response: &provider.ChatResponse{Content: content, StopReason: stop}}
+}
+
+// Fail scripts a request that fails with err.
+func Fail(err error) Step {
+	return Step{Err: err}
+}
+
+// Call builds a tool_use block whose input is input encoded as JSON.
+// A json.RawMessage is used verbatim, which allows malformed input.
+func Call(id, name string, input any) provider.ContentBlock {
+	raw, ok := input.(json.RawMessage)
+	if !ok {
+		var err error
+		if raw, err = json.Marshal(input); err != nil {
+			panic(fmt.Sprintf("fake: encoding input of %s: %v", name, err))
+		}
+	}
+	return provider.NewToolUseBlock(id, name, raw)
+}
+
+// WithUsage sets the token usage reported by the step's response.
+func (s Step) WithUsage(u provider.Usage) Step {
+	if s.Response != nil {
+		resp := *s.Response
+		resp.Usage = u
+		s.Response = &resp
+	}
+	return s
+}
+
+// Expect adds a check run against the request that consumes this step.
+func (s Step) Expect(check func(t testing.TB, params provider.ChatParams)) Step {
+	s.checks = append(s.checks[:len(s.checks):len(s.checks)], check)
+	return s
+}
+
+// Provider replays a script of steps. Requests beyond the end of the script
+// fail the test, as does leaving steps unconsumed when the test ends.
+type Provider struct {
+	t     testing.TB
+	mu    sync.Mutex
+	steps []Step
+	calls []provider.ChatParams
+}
+
+// New creates a provider that serves steps in order.
+func New(t testing.TB, steps ...Step) *Provider {
+	p := &Provider{t: t, steps: steps}
+	t.Cleanup(func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if left := len(p.steps) - len(p.calls); left > 0 {
+			t.Errorf("fake provider: %d of %d scripted steps were not used", left, len(p.steps))
+		}
+	})
+	return p
+}
+
+// Calls returns the requests received so far.
+func (p *Provider) Calls() []provider.ChatParams {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]provider.ChatParams(nil), p.calls...)
+}
+
+func (p *Provider) Chat(ctx context.Context, params provider.ChatParams) (*provider.ChatResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	n := len(p.calls)
+	if n >= len(p.steps) {
+		p.mu.Unlock()
+		p.t.Errorf("fake provider: unexpected request %d, script has only %d steps", n+1, len(p.steps))
+		return nil, fmt.Errorf("fake: script exhausted after %d steps", len(p.steps))
+	}
+	p.calls = append(p.calls, params)
+	step := p.steps[n]
+	p.mu.Unlock()
+
+	for _, check := range step.checks {
+		check(p.t, params)
+	}
+	if step.Err != nil {
+		return nil, step.Err
+	}
+	resp := *step.Response
+	resp.Content = append([]provider.ContentBlock(nil), step.Response.Content...)
+	return &resp, nil
+}
+
+// CountTokens returns provider.EstimateTokens; it does not consume a step.
+func (p *Provider) CountTokens(ctx context.Context, params provider.ChatParams) (int, error) {
+	return provider.EstimateTokens(params), nil
+}
+
+func (p *Provider) ChatStream(ctx context.Context, params provider.ChatParams, onEvent provider.StreamHandler) (*provider.ChatResponse, error) {
+	resp, err := p.Chat(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			onEvent(provider.StreamEvent{Type: provider.StreamEventTextDelta, Text: block.Text})
+		case "thinking":
+			onEvent(provider.StreamEvent{Type: provider.StreamEventThinkingDelta, Text: block.Thinking})
+		case "tool_use":
+			onEvent(provider.StreamEvent{Type: provider.StreamEventToolUseStart, ToolUseID: block.ToolUseID, ToolName: block.ToolName})
+			onEvent(provider.StreamEvent{Type: provider.StreamEventToolUseDelta, ToolUseID: block.ToolUseID, ToolName: block.ToolName, InputDelta: string(block.ToolInput)})
+		}
+	}
+	return resp, nil
+}
@@ -2,20 +2,28 @@ package provider
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"sync/atomic"
 
 	"google.golang.org/genai"
 )
 
+// localCallIDPrefix marks tool-call IDs generated by this provider because
+// Gemini did not supply one. They are never sent back to the API.
+const localCallIDPrefix = "gemini-call-"
+
 type geminiProvider struct {
-	client *genai.Client
-	model  string
+	client  *genai.Client
+	model   string
+	callSeq atomic.Int64
 }
 
 func NewGemini(apiKey, model string) Provider {
 	if model == "" {
-		model = "gemini-2.5-flash"
+		model = DefaultGeminiModel
 	}
 	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
 		APIKey:  apiKey,
@@ -32,27 +40,139 @@ func (g *geminiProvider) Chat(ctx context.Context, params ChatParams) (*ChatResp
 		return nil, fmt.Errorf("gemini client failed to initialize")
 	}
 
+	contents, config := g.buildRequest(params)
+	resp, err := g.client.Models.GenerateContent(ctx, g.model, contents, config)
+	if err != nil {
+		return nil, wrapAPIError("gemini", err)
+	}
+	return g.convertResponse(resp), nil
+}
+
+func (g *geminiProvider) ChatStream(ctx context.Context, params ChatParams, onEvent StreamHandler) (*ChatResponse, error) {
+	if g.client == nil {
+		return nil, fmt.Errorf("gemini client failed to initialize")
+	}
+
+	// Gemini streams complete parts rather than deltas, so accumulate them
+	// into a single candidate, merging consecutive text parts.
+	merged := &genai.Content{Role: genai.RoleModel}
+	var finishReason genai.FinishReason
+	var usage *genai.GenerateContentResponseUsageMetadata
+	var promptFeedback *genai.GenerateContentResponsePromptFeedback
+	contents, config := g.buildRequest(params)
+	for chunk, err := range g.client.Models.GenerateContentStream(ctx, g.model, contents, config) {
+		if err != nil {
+			return nil, wrapAPIError("gemini", err)
+		}
+		// Each chunk reports cumulative usage, so the last one wins.
+		if chunk.UsageMetadata != nil {
+			usage = chunk.UsageMetadata
+		}
+		if chunk.PromptFeedback != nil {
+			promptFeedback = chunk.PromptFeedback
+		}
+		if len(chunk.Candidates) == 0 {
+			continue
+		}
+		if chunk.Candidates[0].FinishReason != "" {
+			finishReason = chunk.Candidates[0].FinishReason
+		}
+		if chunk.Candidates[0].Content == nil {
+			continue
+		}
+
+		for _, part := range chunk.Candidates[0].Content.Parts {
+			if part.Text != "" {
+				eventType := StreamEventTextDelta
+				if part.Thought {
+					eventType = StreamEventThinkingDelta
+				}
+				onEvent(StreamEvent{Type: eventType, Text: part.Text})
+
+				if n := len(merged.Parts); n > 0 {
+					last := merged.Parts[n-1]
+					if last.FunctionCall == nil && last.Thought == part.Thought {
+						last.Text += part.Text
+						if len(part.ThoughtSignature) > 0 {
+							last.ThoughtSignature = part.ThoughtSignature
+						}
+						continue
+					}
+				}
+			}
+			if part.FunctionCall != nil {
+				g.ensureCallID(part.FunctionCall)
+				onEvent(StreamEvent{Type: StreamEventToolUseStart, ToolUseID: part.FunctionCall.ID, ToolName: part.FunctionCall.Name})
+			}
+			merged.Parts = append(merged.Parts, part)
+		}
+	}
+
+	resp := &genai.GenerateContentResponse{
+		Candidates:     []*genai.Candidate{{Content: merged, FinishReason: finishReason}},
+		PromptFeedback: promptFeedback,
+		UsageMetadata:  usage,
+	}
+	return g.convertResponse(resp), nil
+}
+
+func (g *geminiProvider) CountTokens(ctx context.Context, params ChatParams) (int, error) {
+	if g.client == nil {
+		return 0, fmt.Errorf("gemini client failed to initialize")
+	}
+
+	contents, config := g.buildRequest(params)
+	countConfig := &genai.CountTokensConfig{}
+	extra := 0
+	if g.client.ClientConfig().Backend == genai.BackendVertexAI {
+		countConfig.SystemInstruction = config.SystemInstruction
+		countConfig.Tools = config.Tools
+	} else {
+		// The Gemini API only counts contents, so send the system prompt as
+		// a leading message and estimate the tool declarations.
+		if config.SystemInstruction != nil {
+			contents = append([]*genai.Content{{Role: genai.RoleUser, Parts: config.SystemInstruction.Parts}}, contents...)
+		}
+		extra = EstimateTokens(ChatParams{Tools: params.Tools})
+	}
+
+	resp, err := g.client.Models.CountTokens(ctx, g.model, contents, countConfig)
+	if err != nil {
+		return 0, wrapAPIError("gemini", err)
+	}
+	return int(resp.TotalTokens) + extra, nil
+}
+
+// buildRequest converts provider-neutral chat params into Gemini contents and config.
+func (g *geminiProvider) buildRequest(params ChatParams) ([]*genai.Content, *genai.GenerateContentConfig) {
 	// Convert tools to Gemini format
 	var funcDecls []*genai.FunctionDeclaration
 	for _, t := range params.Tools {
-		props := make(map[string]*genai.Schema)
-		for name, val := range t.Parameters {
-			props[name] = convertToGeminiSchema(val)
-		}
-
-		funcDecls = append(funcDecls, &genai.FunctionDeclaration{
+		decl := &genai.FunctionDeclaration{
 			Name:        t.Name,
 			Description: t.Description,
-			Parameters: &genai.Schema{
-				Type:       genai.TypeObject,
-				Properties: props,
-				Required:   t.Required,
-			},
-		})
+		}
+		// Gemini rejects object schemas without properties; a function
+		// that takes no parameters omits the schema instead.
+		if schema := t.inputSchema(); len(schema.Properties) > 0 {
+			decl.Parameters = convertToGeminiSchema(schema)
+		}
+		funcDecls = append(funcDecls, decl)
 	}
 
 	geminiTools := []*genai.Tool{{FunctionDeclarations: funcDecls}}
 
+	// Gemini matches function responses to calls by name, so remember which
+	// function each tool-call ID refers to.
+	callNames := make(map[string]string)
+	for _, msg := range params.Messages {
+		for _, block := range msg.Content {
+			if block.Type == "tool_use" {
+				callNames[block.ToolUseID] = block.ToolName
+			}
+		}
+	}
+
 	// Convert messages to Gemini format
 	var contents []*genai.Content
 
@@ -67,17 +187,34 @@ func (g *geminiProvider) Chat(ctx context.Context, params ChatParams) (*ChatResp
 			switch block.Type {
 			case "text":
 				parts = append(parts, &genai.Part{Text: block.Text})
+			case "image":
+				parts = append(parts, &genai.Part{InlineData: &genai.Blob{Data: block.ImageData, MIMEType: block.MediaType}})
 			case "tool_use":
 				args := make(map[string]any)
 				json.Unmarshal(block.ToolInput, &args)
-				parts = append(parts, genai.NewPartFromFunctionCall(block.ToolName, args))
+				parts = append(parts, &genai.Part{
+					FunctionCall: &genai.FunctionCall{
+						ID:   apiCallID(block.ToolUseID),
+						Name: block.ToolName,
+						Args: args,
+					},
+					ThoughtSignature: decodeSignature(block.Signature),
+				})
 			case "tool_result":
 				response := make(map[string]any)
 				response["result"] = block.ToolResult
 				if block.IsError {
 					response["error"] = true
 				}
-				parts = append(parts, genai.NewPartFromFunctionResponse(block.ToolResultID, response))
+				name, ok := callNames[block.ToolResultID]
+				if !ok {
+					name = block.ToolResultID
+				}
+				parts = append(parts, &genai.Part{FunctionResponse: &genai.FunctionResponse{
+					ID:       apiCallID(block.ToolResultID),
+					Name:     name,
+					Response: response,
+				}})
 			}
 		}
 
@@ -90,7 +227,32 @@ func (g *geminiProvider) Chat(ctx context.Context, params ChatParams) (*ChatResp
 	}
 
 	config := &genai.GenerateContentConfig{
-		Tools: geminiTools,
+		Tools:           geminiTools,
+		MaxOutputTokens: int32(params.MaxTokens),
+	}
+	if budget := params.Reasoning.Budget(); budget > 0 {
+		// Thoughts count against the output limit, which the caller has
+		// already fitted to the model and the context window, so the
+		// budget shrinks to fit below it.
+		if params.MaxTokens > 0 {
+			budget = min(budget, params.MaxTokens-1)
+		}
+		thinkingBudget := int32(budget)
+		config.ThinkingConfig = &genai.ThinkingConfig{
+			ThinkingBudget:  &thinkingBudget,
+			IncludeThoughts: true,
+		}
+	}
+	switch params.ToolChoice.Mode {
+	case ToolChoiceAny:
+		config.ToolConfig = &genai.ToolConfig{FunctionCallingConfig: &genai.FunctionCallingConfig{Mode: genai.FunctionCallingConfigModeAny}}
+	case ToolChoiceNone:
+		config.ToolConfig = &genai.ToolConfig{FunctionCallingConfig: &genai.FunctionCallingConfig{Mode: genai.FunctionCallingConfigModeNone}}
+	case ToolChoiceTool:
+		config.ToolConfig = &genai.ToolConfig{FunctionCallingConfig: &genai.FunctionCallingConfig{
+			Mode:                 genai.FunctionCallingConfigModeAny,
+			AllowedFunctionNames: []string{params.ToolChoice.Name},
+		}}
 	}
 	if params.System != "" {
 		config.SystemInstruction = &genai.Content{
@@ -98,11 +260,28 @@ func (g *geminiProvider) Chat(ctx context.Context, params ChatParams) (*ChatResp
 		}
 	}
 
-	resp, err := g.client.Models.GenerateContent(ctx, g.model, contents, config)
-	if err != nil {
-		return nil, fmt.Errorf("gemini API error: %w", err)
+	return contents, config
+}
+
+// ensureCallID assigns a unique local ID to a function call that Gemini
+// returned without one, so parallel calls to the same function stay distinct.
+func (g *geminiProvider) ensureCallID(call *genai.FunctionCall) {
+	if call.ID == "" {
+		call.ID = fmt.Sprintf("%s%d-%s", localCallIDPrefix, g.callSeq.Add(1), call.Name)
 	}
+}
 
+// apiCallID returns the ID to send to Gemini for a tool call: the
+// server-issued ID, or "" for IDs generated locally by ensureCallID.
+func apiCallID(id string) string {
+	if strings.HasPrefix(id, localCallIDPrefix) {
+		return ""
+	}
+	return id
+}
+
+// convertResponse converts a Gemini response into a ChatResponse.
+func (g *geminiProvider) convertResponse(resp *genai.GenerateContentResponse) *ChatResponse {
 	// Convert response
 	var content []ContentBlock
 	hasToolCalls := false
@@ -110,13 +289,19 @@ func (g *geminiProvider) Chat(ctx context.Context, params ChatParams) (*ChatResp
 	if len(resp.Candidates) > 0 && resp.Candidates[0].Content != nil {
 		for _, part := range resp.Candidates[0].Content.Parts {
 			if part.Text != "" {
-				content = append(content, NewTextBlock(part.Text))
+				if part.Thought {
+					content = append(content, NewThinkingBlock(part.Text, encodeSignature(part.ThoughtSignature)))
+				} else {
+					content = append(content, NewTextBlock(part.Text))
+				}
 			}
 			if part.FunctionCall != nil {
 				hasToolCalls = true
+				g.ensureCallID(part.FunctionCall)
 				argsRaw, _ := json.Marshal(part.FunctionCall.Args)
-				id := fmt.Sprintf("call_%s", part.FunctionCall.Name)
-				content = append(content, NewToolUseBlock(id, part.FunctionCall.Name, argsRaw))
+				block := NewToolUseBlock(part.FunctionCall.ID, part.FunctionCall.Name, argsRaw)
+				block.Signature = encodeSignature(part.ThoughtSignature)
+				content = append(content, block)
 			}
 		}
 	}
@@ -125,22 +310,72 @@ func (g *geminiProvider) Chat(ctx context.Context, params ChatParams) (*ChatResp
 	if hasToolCalls {
 		stopReason = StopReasonToolUse
 	}
+	if len(resp.Candidates) > 0 {
+		switch resp.Candidates[0].FinishReason {
+		case genai.FinishReasonMaxTokens:
+			stopReason = StopReasonMaxTokens
+		case genai.FinishReasonSafety, genai.FinishReasonRecitation, genai.FinishReasonBlocklist,
+			genai.FinishReasonProhibitedContent, genai.FinishReasonSPII:
+			stopReason = StopReasonContentFiltered
+		}
+	}
+	// A blocked prompt produces no candidates at all.
+	if resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != "" {
+		stopReason = StopReasonContentFiltered
+	}
 
-	return &ChatResponse{Content: content, StopReason: stopReason}, nil
+	var usage Usage
+	if meta := resp.UsageMetadata; meta != nil {
+		usage = Usage{
+			InputTokens:     int(meta.PromptTokenCount - meta.CachedContentTokenCount),
+			OutputTokens:    int(meta.CandidatesTokenCount + meta.ThoughtsTokenCount),
+			CacheReadTokens: int(meta.CachedContentTokenCount),
+		}
+	}
+
+	return &ChatResponse{Content: content, StopReason: stopReason, Usage: usage}
 }
 
-func convertToGeminiSchema(val interface{}) *genai.Schema {
-	m, ok := val.(map[string]interface{})
-	if !ok {
-		return &genai.Schema{Type: genai.TypeString}
+// encodeSignature stores a Gemini thought signature in a ContentBlock.
+func encodeSignature(sig []byte) string {
+	if len(sig) == 0 {
+		return ""
 	}
+	return base64.StdEncoding.EncodeToString(sig)
+}
 
-	schema := &genai.Schema{}
-	if t, ok := m["type"].(string); ok {
-		schema.Type = genai.Type(t)
+// decodeSignature restores a thought signature stored by encodeSignature.
+// Malformed signatures are dropped.
+func decodeSignature(sig string) []byte {
+	data, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return nil
 	}
-	if d, ok := m["description"].(string); ok {
-		schema.Description = d
+	return data
+}
+
+// convertToGeminiSchema translates a schema into Gemini's OpenAPI-style
+// schema, which uses upper-case type names.
+func convertToGeminiSchema(s *Schema) *genai.Schema {
+	schema := &genai.Schema{
+		Type:        genai.Type(strings.ToUpper(s.Type)),
+		Description: s.Description,
+		Enum:        s.Enum,
+		Default:     s.Default,
+	}
+	if len(s.Enum) > 0 {
+		schema.Format = "enum"
+	}
+	if s.Items != nil {
+		schema.Items = convertToGeminiSchema(s.Items)
+	}
+	if len(s.Properties) > 0 {
+		schema.Properties = make(map[string]*genai.Schema, len(s.Properties))
+		for name, prop := range s.Properties {
+			schema.Properties[name] = convertToGeminiSchema(prop)
+		}
+		schema.PropertyOrdering = s.propertyNames()
+		schema.Required = s.Required
 	}
 	return schema
 }
@@ -0,0 +1,103 @@
+package provider
+
+import "strings"
+
+// DefaultMaxTokens is the per-response output limit used for models the
+// registry does not know.
+const DefaultMaxTokens = 8192
+
+// ModelInfo describes the limits and features of a model.
+type ModelInfo struct {
+	ContextWindow   int  `json:"context_window"`    // input + output tokens per request
+	MaxOutputTokens int  `json:"max_output_tokens"` // largest output a single response may produce
+	MaxTokens       int  `json:"max_tokens"`        // default output limit per response
+	Images          bool `json:"images"`            // accepts image content blocks
+	ParallelTools   bool `json:"parallel_tools"`    // may request several tools in one response
+	Reasoning       bool `json:"reasoning"`         // supports a thinking budget or reasoning effort
+}
+
+// DefaultCompactionFraction is the share of the usable context window (the
+// window less the output allowance) a prompt may fill before compaction.
+const DefaultCompactionFraction = 0.75
+
+// CompactionThreshold returns the prompt size, in tokens, above which the
+// conversation should be compacted to stay clear of the context window.
+// fraction is the share of the usable window; 0 means DefaultCompactionFraction.
+// maxTokens is the output allowance of the request being fitted.
+func (m ModelInfo) CompactionThreshold(fraction float64, maxTokens int) int {
+	if fraction <= 0 {
+		fraction = DefaultCompactionFraction
+	}
+	return int(float64(m.ContextWindow-maxTokens) * fraction)
+}
+
+// ModelTable maps model-name prefixes (e.g. "claude-sonnet-4-5") to model
+// info. The longest matching prefix wins, so one entry covers every dated
+// snapshot and the Vertex AI "@" variants of a model.
+type ModelTable map[string]ModelInfo
+
+// DefaultModels covers the models of each provider the action is tested with.
+var DefaultModels = ModelTable{
+	"claude-sonnet-4-5": {ContextWindow: 200_000, MaxOutputTokens: 64_000, MaxTokens: 16_384, Images: true, ParallelTools: true, Reasoning: true},
+	"claude-sonnet-4":   {ContextWindow: 200_000, MaxOutputTokens: 64_000, MaxTokens: 8192, Images: true, ParallelTools: true, Reasoning: true},
+	"claude-haiku-4-5":  {ContextWindow: 200_000, MaxOutputTokens: 64_000, MaxTokens: 8192, Images: true, ParallelTools: true, Reasoning: true},
+	"claude-opus-4":     {ContextWindow: 200_000, MaxOutputTokens: 32_000, MaxTokens: 8192, Images: true, ParallelTools: true, Reasoning: true},
+	"claude-3-7-sonnet": {ContextWindow: 200_000, MaxOutputTokens: 64_000, MaxTokens: 8192, Images: true, ParallelTools: true, Reasoning: true},
+	"claude-3-5-haiku":  {ContextWindow: 200_000, MaxOutputTokens: 8192, MaxTokens: 8192, Images: true, ParallelTools: true},
+	"gpt-4o":            {ContextWindow: 128_000, MaxOutputTokens: 16_384, MaxTokens: 8192, Images: true, ParallelTools: true},
+	"gpt-4.1":           {ContextWindow: 1_047_576, MaxOutputTokens: 32_768, MaxTokens: 8192, Images: true, ParallelTools: true},
+	"gpt-5":             {ContextWindow: 400_000, MaxOutputTokens: 128_000, MaxTokens: 16_384, Images: true, ParallelTools: true, Reasoning: true},
+	"o3":                {ContextWindow: 200_000, MaxOutputTokens: 100_000, MaxTokens: 16_384, Images: true, ParallelTools: true, Reasoning: true},
+	"o4-mini":           {ContextWindow: 200_000, MaxOutputTokens: 100_000, MaxTokens: 16_384, Images: true, ParallelTools: true, Reasoning: true},
+	"gemini-2.5":        {ContextWindow: 1_048_576, MaxOutputTokens: 65_536, MaxTokens: 16_384, Images: true, ParallelTools: true, Reasoning: true},
+	"gemini-2.0-flash":  {ContextWindow: 1_048_576, MaxOutputTokens: 8192, MaxTokens: 8192, Images: true, ParallelTools: true},
+}
+
+// unknownModel is assumed for models missing from both tables: a modest
+// context window, and every feature left on so the API decides what it rejects.
+var unknownModel = ModelInfo{
+	ContextWindow:   128_000,
+	MaxOutputTokens: DefaultMaxTokens,
+	MaxTokens:       DefaultMaxTokens,
+	Images:          true,
+	ParallelTools:   true,
+	Reasoning:       true,
+}
+
+// LookupModel finds the info for a model, consulting overrides before
+// DefaultModels. Unknown models get conservative limits and report false.
+func LookupModel(overrides ModelTable, model string) (ModelInfo, bool) {
+	if info, ok := overrides.match(model); ok {
+		return info, true
+	}
+	if info, ok := DefaultModels.match(model); ok {
+		return info, true
+	}
+	return unknownModel, false
+}
+
+// match returns the entry with the longest prefix of model.
+func (t ModelTable) match(model string) (ModelInfo, bool) {
+	best := ""
+	found := false
+	for prefix := range t {
+		if strings.HasPrefix(model, prefix) && (!found || len(prefix) > len(best)) {
+			best, found = prefix, true
+		}
+	}
+	if !found {
+		return ModelInfo{}, false
+	}
+
+	info := t[best]
+	if info.MaxOutputTokens == 0 {
+		info.MaxOutputTokens = DefaultMaxTokens
+	}
+	if info.MaxTokens == 0 || info.MaxTokens > info.MaxOutputTokens {
+		info.MaxTokens = min(DefaultMaxTokens, info.MaxOutputTokens)
+	}
+	if info.ContextWindow == 0 {
+		info.ContextWindow = unknownModel.ContextWindow
+	}
+	return info, true
+}
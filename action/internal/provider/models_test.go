@@ -0,0 +1,36 @@
+package provider
+
+import "testing"
+
+func TestLookupModel(t *testing.T) {
+	overrides := ModelTable{
+		"llama3":            {ContextWindow: 8192, MaxOutputTokens: 4096},
+		"claude-sonnet-4-5": {ContextWindow: 1_000_000, MaxOutputTokens: 64_000, MaxTokens: 32_000, Images: true},
+	}
+
+	tests := []struct {
+		model       string
+		wantKnown   bool
+		wantContext int
+		wantOutput  int
+		wantDefault int
+	}{
+		// Longest prefix wins: sonnet-4-5 over sonnet-4.
+		{"claude-sonnet-4-20250514", true, 200_000, 64_000, 8192},
+		{"claude-sonnet-4-5@20250929", true, 1_000_000, 64_000, 32_000},
+		{"gpt-4o-mini", true, 128_000, 16_384, 8192},
+		// Overrides fill in a default per-response limit.
+		{"llama3:70b", true, 8192, 4096, 4096},
+		{"mystery-model", false, 128_000, DefaultMaxTokens, DefaultMaxTokens},
+	}
+	for _, tt := range tests {
+		info, ok := LookupModel(overrides, tt.model)
+		if ok != tt.wantKnown {
+			t.Errorf("%s: known = %v, want %v", tt.model, ok, tt.wantKnown)
+		}
+		if info.ContextWindow != tt.wantContext || info.MaxOutputTokens != tt.wantOutput || info.MaxTokens != tt.wantDefault {
+			t.Errorf("%s: got context %d, output %d, default %d; want %d, %d, %d", tt.model,
+				info.ContextWindow, info.MaxOutputTokens, info.MaxTokens, tt.wantContext, tt.wantOutput, tt.wantDefault)
+		}
+	}
+}
@@ -2,10 +2,13 @@ package provider
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/azure"
 	"github.com/openai/openai-go/option"
 	"github.com/openai/openai-go/packages/param"
 	"github.com/openai/openai-go/shared"
@@ -14,34 +17,126 @@ import (
 type openaiProvider struct {
 	client *openai.Client
 	model  string
+	// legacyMaxTokens sends the output limit as max_tokens, for servers
+	// that do not accept max_completion_tokens.
+	legacyMaxTokens bool
 }
 
 func NewOpenAI(apiKey, model string) Provider {
 	if model == "" {
-		model = "gpt-4o"
+		model = DefaultOpenAIModel
 	}
-	client := openai.NewClient(option.WithAPIKey(apiKey))
+	client := openai.NewClient(option.WithAPIKey(apiKey), option.WithMaxRetries(0))
 	return &openaiProvider{client: &client, model: model}
 }
 
+// azureMaxCompletionTokensVersion is the first Azure OpenAI api-version that
+// accepts max_completion_tokens.
+const azureMaxCompletionTokensVersion = "2024-09-01"
+
+// NewAzureOpenAI creates a provider for an Azure OpenAI deployment. Requests
+// go to {endpoint}/openai/deployments/{deployment} with the given api-version
+// and are authenticated with the resource's API key.
+func NewAzureOpenAI(endpoint, deployment, apiVersion, apiKey string) Provider {
+	client := openai.NewClient(
+		azure.WithEndpoint(endpoint, apiVersion),
+		azure.WithAPIKey(apiKey),
+		option.WithMaxRetries(0),
+	)
+	// api-versions are dates, optionally suffixed with -preview, so they
+	// order as strings.
+	return &openaiProvider{client: &client, model: deployment, legacyMaxTokens: apiVersion < azureMaxCompletionTokensVersion}
+}
+
+// NewOpenAICompatible creates a provider for servers that implement the OpenAI
+// Chat Completions API, such as vLLM, Ollama or LM Studio. The API key is
+// optional since many self-hosted gateways do not require one. The output
+// limit is sent as max_tokens, which these servers support more widely than
+// max_completion_tokens.
+func NewOpenAICompatible(baseURL, apiKey, model string, headers map[string]string) Provider {
+	opts := []option.RequestOption{option.WithBaseURL(baseURL), option.WithMaxRetries(0)}
+	if apiKey != "" {
+		opts = append(opts, option.WithAPIKey(apiKey))
+	}
+	for name, value := range headers {
+		opts = append(opts, option.WithHeader(name, value))
+	}
+	client := openai.NewClient(opts...)
+	return &openaiProvider{client: &client, model: model, legacyMaxTokens: true}
+}
+
 func (o *openaiProvider) Chat(ctx context.Context, params ChatParams) (*ChatResponse, error) {
+	resp, err := o.client.Chat.Completions.New(ctx, o.buildRequest(params))
+	if err != nil {
+		return nil, wrapAPIError("openai", err)
+	}
+	return convertOpenAIResponse(resp)
+}
+
+func (o *openaiProvider) ChatStream(ctx context.Context, params ChatParams, onEvent StreamHandler) (*ChatResponse, error) {
+	req := o.buildRequest(params)
+	req.StreamOptions.IncludeUsage = param.NewOpt(true)
+	stream := o.client.Chat.Completions.NewStreaming(ctx, req)
+	defer stream.Close()
+
+	acc := openai.ChatCompletionAccumulator{}
+	var usage openai.CompletionUsage
+	for stream.Next() {
+		chunk := stream.Current()
+		if !acc.AddChunk(chunk) {
+			return nil, fmt.Errorf("openai stream error: could not accumulate chunk %s", chunk.ID)
+		}
+		// Usage arrives in a final chunk with no choices; the accumulator
+		// drops the cached-token details, so keep the chunk's copy.
+		if chunk.JSON.Usage.Valid() {
+			usage = chunk.Usage
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		delta := chunk.Choices[0].Delta
+		if delta.Content != "" {
+			onEvent(StreamEvent{Type: StreamEventTextDelta, Text: delta.Content})
+		}
+		for _, tc := range delta.ToolCalls {
+			call := acc.Choices[0].Message.ToolCalls[tc.Index]
+			if tc.ID != "" {
+				onEvent(StreamEvent{Type: StreamEventToolUseStart, ToolUseID: call.ID, ToolName: call.Function.Name})
+			}
+			if tc.Function.Arguments != "" {
+				onEvent(StreamEvent{Type: StreamEventToolUseDelta, ToolUseID: call.ID, ToolName: call.Function.Name, InputDelta: tc.Function.Arguments})
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, wrapAPIError("openai", err)
+	}
+
+	acc.ChatCompletion.Usage = usage
+	return convertOpenAIResponse(&acc.ChatCompletion)
+}
+
+// CountTokens estimates offline; OpenAI has no token counting endpoint.
+func (o *openaiProvider) CountTokens(ctx context.Context, params ChatParams) (int, error) {
+	return EstimateTokens(params), nil
+}
+
+// buildRequest converts provider-neutral chat params into a Chat Completions request.
+func (o *openaiProvider) buildRequest(params ChatParams) openai.ChatCompletionNewParams {
 	// Convert tools
 	tools := make([]openai.ChatCompletionToolParam, len(params.Tools))
 	for i, t := range params.Tools {
-		schema := shared.FunctionParameters{
-			"type":       "object",
-			"properties": t.Parameters,
+		fn := shared.FunctionDefinitionParam{
+			Name:        t.Name,
+			Description: param.NewOpt(t.Description),
+			Parameters:  shared.FunctionParameters(t.inputSchema().JSONSchema()),
 		}
-		if len(t.Required) > 0 {
-			schema["required"] = t.Required
-		}
-		tools[i] = openai.ChatCompletionToolParam{
-			Function: shared.FunctionDefinitionParam{
-				Name:        t.Name,
-				Description: param.NewOpt(t.Description),
-				Parameters:  schema,
-			},
+		if t.Strict {
+			fn.Parameters = shared.FunctionParameters(strictJSONSchema(t.inputSchema(), true))
+			fn.Strict = param.NewOpt(true)
 		}
+		tools[i] = openai.ChatCompletionToolParam{Function: fn}
 	}
 
 	// Convert messages
@@ -54,22 +149,34 @@ func (o *openaiProvider) Chat(ctx context.Context, params ChatParams) (*ChatResp
 	for _, msg := range params.Messages {
 		switch msg.Role {
 		case RoleUser:
+			// Tool results must directly follow the assistant's tool calls,
+			// so they go first and the rest becomes a single user message.
+			var parts []openai.ChatCompletionContentPartUnionParam
 			for _, block := range msg.Content {
 				switch block.Type {
 				case "text":
-					messages = append(messages, openai.UserMessage(block.Text))
+					parts = append(parts, openai.TextContentPart(block.Text))
+				case "image":
+					dataURL := fmt.Sprintf("data:%s;base64,%s", block.MediaType, base64.StdEncoding.EncodeToString(block.ImageData))
+					parts = append(parts, openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{URL: dataURL}))
 				case "tool_result":
 					messages = append(messages, openai.ToolMessage(block.ToolResult, block.ToolResultID))
 				}
 			}
+			// Plain text stays a string, which every compatible server accepts.
+			if len(parts) == 1 && parts[0].OfText != nil {
+				messages = append(messages, openai.UserMessage(parts[0].OfText.Text))
+			} else if len(parts) > 0 {
+				messages = append(messages, openai.UserMessage(parts))
+			}
 		case RoleAssistant:
 			var toolCalls []openai.ChatCompletionMessageToolCallParam
-			var textContent string
+			var texts []string
 
 			for _, block := range msg.Content {
 				switch block.Type {
 				case "text":
-					textContent = block.Text
+					texts = append(texts, block.Text)
 				case "tool_use":
 					toolCalls = append(toolCalls, openai.ChatCompletionMessageToolCallParam{
 						ID: block.ToolUseID,
@@ -82,7 +189,7 @@ func (o *openaiProvider) Chat(ctx context.Context, params ChatParams) (*ChatResp
 			}
 
 			assistantMsg := openai.ChatCompletionAssistantMessageParam{}
-			if textContent != "" {
+			if textContent := strings.Join(texts, "\n\n"); textContent != "" {
 				assistantMsg.Content.OfString = param.NewOpt(textContent)
 			}
 			if len(toolCalls) > 0 {
@@ -92,15 +199,36 @@ func (o *openaiProvider) Chat(ctx context.Context, params ChatParams) (*ChatResp
 		}
 	}
 
-	resp, err := o.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+	req := openai.ChatCompletionNewParams{
 		Model:    o.model,
 		Messages: messages,
 		Tools:    tools,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("openai API error: %w", err)
 	}
+	if params.MaxTokens > 0 && o.legacyMaxTokens {
+		req.MaxTokens = openai.Int(int64(params.MaxTokens))
+	} else if params.MaxTokens > 0 {
+		req.MaxCompletionTokens = openai.Int(int64(params.MaxTokens))
+	}
+	switch params.ToolChoice.Mode {
+	case ToolChoiceAny:
+		req.ToolChoice.OfAuto = param.NewOpt("required")
+	case ToolChoiceNone:
+		req.ToolChoice.OfAuto = param.NewOpt("none")
+	case ToolChoiceTool:
+		req.ToolChoice = openai.ChatCompletionToolChoiceOptionParamOfChatCompletionNamedToolChoice(
+			openai.ChatCompletionNamedToolChoiceFunctionParam{Name: params.ToolChoice.Name})
+	}
+	if params.SerialTools && len(tools) > 0 {
+		req.ParallelToolCalls = openai.Bool(false)
+	}
+	if effort := params.Reasoning.EffortLevel(); effort != "" {
+		req.ReasoningEffort = shared.ReasoningEffort(effort)
+	}
+	return req
+}
 
+// convertOpenAIResponse converts a chat completion into a ChatResponse.
+func convertOpenAIResponse(resp *openai.ChatCompletion) (*ChatResponse, error) {
 	if len(resp.Choices) == 0 {
 		return nil, fmt.Errorf("openai returned no choices")
 	}
@@ -118,11 +246,62 @@ func (o *openaiProvider) Chat(ctx context.Context, params ChatParams) (*ChatResp
 	}
 
 	stopReason := StopReasonEndTurn
-	if choice.FinishReason == "tool_calls" || choice.FinishReason == "function_call" {
+	switch {
+	case choice.FinishReason == "tool_calls" || choice.FinishReason == "function_call":
 		stopReason = StopReasonToolUse
-	} else if choice.FinishReason == "length" {
+	case choice.FinishReason == "length":
 		stopReason = StopReasonMaxTokens
+	case choice.FinishReason == "content_filter":
+		stopReason = StopReasonContentFiltered
+	case choice.Message.Refusal != "":
+		stopReason = StopReasonRefusal
+		content = append(content, NewTextBlock(choice.Message.Refusal))
 	}
 
-	return &ChatResponse{Content: content, StopReason: stopReason}, nil
+	cached := int(resp.Usage.PromptTokensDetails.CachedTokens)
+	usage := Usage{
+		InputTokens:     int(resp.Usage.PromptTokens) - cached,
+		OutputTokens:    int(resp.Usage.CompletionTokens),
+		CacheReadTokens: cached,
+	}
+
+	return &ChatResponse{Content: content, StopReason: stopReason, Usage: usage}, nil
+}
+
+// strictJSONSchema converts a schema to the form OpenAI strict mode accepts:
+// every object forbids additional properties and lists all of its
+// properties as required, optional properties become nullable instead, and
+// defaults (unsupported in strict mode) are dropped.
+func strictJSONSchema(s *Schema, required bool) map[string]any {
+	out := map[string]any{"type": s.Type}
+	if !required {
+		out["type"] = []string{s.Type, "null"}
+	}
+	if s.Description != "" {
+		out["description"] = s.Description
+	}
+	if len(s.Enum) > 0 {
+		enum := make([]any, 0, len(s.Enum)+1)
+		for _, v := range s.Enum {
+			enum = append(enum, v)
+		}
+		if !required {
+			enum = append(enum, nil)
+		}
+		out["enum"] = enum
+	}
+	if s.Items != nil {
+		out["items"] = strictJSONSchema(s.Items, true)
+	}
+	if s.Type == TypeObject {
+		names := s.propertyNames()
+		props := make(map[string]any, len(names))
+		for _, name := range names {
+			props[name] = strictJSONSchema(s.Properties[name], s.isRequired(name))
+		}
+		out["properties"] = props
+		out["required"] = names
+		out["additionalProperties"] = false
+	}
+	return out
 }
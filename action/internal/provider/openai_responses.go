@@ -0,0 +1,249 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/packages/param"
+	"github.com/openai/openai-go/responses"
+	"github.com/openai/openai-go/shared"
+)
+
+// openaiResponsesProvider talks to OpenAI's Responses API. Requests are
+// stateless (store=false): the whole conversation is sent every turn, and
+// reasoning items come back encrypted so they can be passed through on the
+// next request, which reasoning models need to keep their chain of thought
+// across tool calls.
+//
+// Server-side state (store=true with previous_response_id chaining) is
+// deliberately not supported. The agent owns the transcript: compaction
+// rewrites older turns, a fallback resends the conversation to another
+// provider, and cassettes replay requests by their full content, none of
+// which a chain of stored responses can follow. Stored responses would also
+// keep ticket and repository content on OpenAI's servers for the retention
+// period, which a CI run should not opt into implicitly.
+type openaiResponsesProvider struct {
+	client *openai.Client
+	model  string
+}
+
+// NewOpenAIResponses creates an OpenAI provider that uses the Responses API
+// instead of Chat Completions.
+func NewOpenAIResponses(apiKey, model string) Provider {
+	if model == "" {
+		model = DefaultOpenAIModel
+	}
+	client := openai.NewClient(option.WithAPIKey(apiKey), option.WithMaxRetries(0))
+	return &openaiResponsesProvider{client: &client, model: model}
+}
+
+func (o *openaiResponsesProvider) Chat(ctx context.Context, params ChatParams) (*ChatResponse, error) {
+	resp, err := o.client.Responses.New(ctx, o.buildRequest(params))
+	if err != nil {
+		return nil, wrapAPIError("openai", err)
+	}
+	return convertResponsesOutput(resp), nil
+}
+
+func (o *openaiResponsesProvider) ChatStream(ctx context.Context, params ChatParams, onEvent StreamHandler) (*ChatResponse, error) {
+	stream := o.client.Responses.NewStreaming(ctx, o.buildRequest(params))
+	defer stream.Close()
+
+	// Argument deltas reference the output item, not the call ID.
+	calls := make(map[string]responses.ResponseOutputItemUnion)
+	var final *responses.Response
+	for stream.Next() {
+		ev := stream.Current()
+		switch ev.Type {
+		case "response.output_text.delta":
+			onEvent(StreamEvent{Type: StreamEventTextDelta, Text: ev.Delta.OfString})
+		case "response.reasoning_summary_text.delta":
+			onEvent(StreamEvent{Type: StreamEventThinkingDelta, Text: ev.Delta.OfString})
+		case "response.output_item.added":
+			if ev.Item.Type == "function_call" {
+				calls[ev.Item.ID] = ev.Item
+				onEvent(StreamEvent{Type: StreamEventToolUseStart, ToolUseID: ev.Item.CallID, ToolName: ev.Item.Name})
+			}
+		case "response.function_call_arguments.delta":
+			call := calls[ev.ItemID]
+			onEvent(StreamEvent{Type: StreamEventToolUseDelta, ToolUseID: call.CallID, ToolName: call.Name, InputDelta: ev.Delta.OfString})
+		case "response.completed", "response.incomplete":
+			resp := ev.Response
+			final = &resp
+		case "response.failed":
+			return nil, newAPIError("openai", string(ev.Response.Error.Code), ev.Response.Error.Message)
+		case "error":
+			return nil, newAPIError("openai", ev.Code, ev.Message)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, wrapAPIError("openai", err)
+	}
+	if final == nil {
+		return nil, fmt.Errorf("openai stream ended without a final response")
+	}
+	return convertResponsesOutput(final), nil
+}
+
+// CountTokens estimates offline, like the Chat Completions provider.
+func (o *openaiResponsesProvider) CountTokens(ctx context.Context, params ChatParams) (int, error) {
+	return EstimateTokens(params), nil
+}
+
+// buildRequest converts provider-neutral chat params into a Responses API request.
+func (o *openaiResponsesProvider) buildRequest(params ChatParams) responses.ResponseNewParams {
+	// Convert tools
+	tools := make([]responses.ToolUnionParam, len(params.Tools))
+	for i, t := range params.Tools {
+		schema := t.inputSchema().JSONSchema()
+		if t.Strict {
+			schema = strictJSONSchema(t.inputSchema(), true)
+		}
+		tool := responses.ToolParamOfFunction(t.Name, schema, t.Strict)
+		tool.OfFunction.Description = param.NewOpt(t.Description)
+		tools[i] = tool
+	}
+
+	// Convert messages to input items
+	var input responses.ResponseInputParam
+	for _, msg := range params.Messages {
+		switch msg.Role {
+		case RoleUser:
+			var parts responses.ResponseInputMessageContentListParam
+			for _, block := range msg.Content {
+				switch block.Type {
+				case "text":
+					parts = append(parts, responses.ResponseInputContentParamOfInputText(block.Text))
+				case "image":
+					image := responses.ResponseInputContentParamOfInputImage(responses.ResponseInputImageDetailAuto)
+					image.OfInputImage.ImageURL = param.NewOpt("data:" + block.MediaType + ";base64," + base64.StdEncoding.EncodeToString(block.ImageData))
+					parts = append(parts, image)
+				case "tool_result":
+					input = append(input, responses.ResponseInputItemParamOfFunctionCallOutput(block.ToolResultID, block.ToolResult))
+				}
+			}
+			// Function call outputs must directly follow their calls, so
+			// any text in the same message goes after them.
+			if len(parts) > 0 {
+				input = append(input, responses.ResponseInputItemParamOfMessage(parts, responses.EasyInputMessageRoleUser))
+			}
+
+		case RoleAssistant:
+			for _, block := range msg.Content {
+				switch block.Type {
+				case "text":
+					input = append(input, responses.ResponseInputItemParamOfMessage(block.Text, responses.EasyInputMessageRoleAssistant))
+				case "thinking":
+					// Only reasoning items from this API carry an item ID.
+					if block.Data == "" {
+						continue
+					}
+					var summary []responses.ResponseReasoningItemSummaryParam
+					if block.Thinking != "" {
+						summary = append(summary, responses.ResponseReasoningItemSummaryParam{Text: block.Thinking})
+					}
+					item := responses.ResponseInputItemParamOfReasoning(block.Data, summary)
+					if block.Signature != "" {
+						item.OfReasoning.EncryptedContent = param.NewOpt(block.Signature)
+					}
+					input = append(input, item)
+				case "tool_use":
+					input = append(input, responses.ResponseInputItemParamOfFunctionCall(string(block.ToolInput), block.ToolUseID, block.ToolName))
+				}
+			}
+		}
+	}
+
+	req := responses.ResponseNewParams{
+		Model: o.model,
+		Input: responses.ResponseNewParamsInputUnion{OfInputItemList: input},
+		Tools: tools,
+		Store: param.NewOpt(false), // see openaiResponsesProvider
+	}
+	if params.System != "" {
+		req.Instructions = param.NewOpt(params.System)
+	}
+	if params.MaxTokens > 0 {
+		req.MaxOutputTokens = param.NewOpt(int64(params.MaxTokens))
+	}
+	switch params.ToolChoice.Mode {
+	case ToolChoiceAny:
+		req.ToolChoice.OfToolChoiceMode = param.NewOpt(responses.ToolChoiceOptionsRequired)
+	case ToolChoiceNone:
+		req.ToolChoice.OfToolChoiceMode = param.NewOpt(responses.ToolChoiceOptionsNone)
+	case ToolChoiceTool:
+		req.ToolChoice.OfFunctionTool = &responses.ToolChoiceFunctionParam{Name: params.ToolChoice.Name}
+	}
+	if params.SerialTools && len(tools) > 0 {
+		req.ParallelToolCalls = param.NewOpt(false)
+	}
+	if effort := params.Reasoning.EffortLevel(); effort != "" {
+		req.Reasoning = shared.ReasoningParam{
+			Effort:  shared.ReasoningEffort(effort),
+			Summary: shared.ReasoningSummaryAuto,
+		}
+		req.Include = []responses.ResponseIncludable{responses.ResponseIncludableReasoningEncryptedContent}
+	}
+	return req
+}
+
+// convertResponsesOutput converts a Responses API response into a ChatResponse.
+// Reasoning items become thinking blocks carrying the summary as Thinking,
+// the encrypted content as Signature and the item ID as Data.
+func convertResponsesOutput(resp *responses.Response) *ChatResponse {
+	var content []ContentBlock
+	hasToolCalls := false
+	refused := false
+
+	for _, item := range resp.Output {
+		switch item.Type {
+		case "reasoning":
+			summary := make([]string, 0, len(item.Summary))
+			for _, s := range item.Summary {
+				summary = append(summary, s.Text)
+			}
+			block := NewThinkingBlock(strings.Join(summary, "\n\n"), item.EncryptedContent)
+			block.Data = item.ID
+			content = append(content, block)
+		case "message":
+			for _, part := range item.Content {
+				switch {
+				case part.Type == "output_text" && part.Text != "":
+					content = append(content, NewTextBlock(part.Text))
+				case part.Type == "refusal":
+					refused = true
+					content = append(content, NewTextBlock(part.Refusal))
+				}
+			}
+		case "function_call":
+			hasToolCalls = true
+			content = append(content, NewToolUseBlock(item.CallID, item.Name, json.RawMessage(item.Arguments)))
+		}
+	}
+
+	stopReason := StopReasonEndTurn
+	switch {
+	case resp.Status == responses.ResponseStatusIncomplete && resp.IncompleteDetails.Reason == "max_output_tokens":
+		stopReason = StopReasonMaxTokens
+	case resp.Status == responses.ResponseStatusIncomplete && resp.IncompleteDetails.Reason == "content_filter":
+		stopReason = StopReasonContentFiltered
+	case hasToolCalls:
+		stopReason = StopReasonToolUse
+	case refused:
+		stopReason = StopReasonRefusal
+	}
+
+	cached := int(resp.Usage.InputTokensDetails.CachedTokens)
+	usage := Usage{
+		InputTokens:     int(resp.Usage.InputTokens) - cached,
+		OutputTokens:    int(resp.Usage.OutputTokens),
+		CacheReadTokens: cached,
+	}
+
+	return &ChatResponse{Content: content, StopReason: stopReason, Usage: usage}
+}
@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/openai/openai-go/responses"
+)
+
+func TestResponsesRequestInputItems(t *testing.T) {
+	p := NewOpenAIResponses("test-key", "o4-mini").(*openaiResponsesProvider)
+	req := p.buildRequest(ChatParams{
+		System: "system",
+		Messages: []Message{
+			UserMessage(NewTextBlock("fix the bug")),
+			AssistantMessage(
+				ContentBlock{Type: "thinking", Thinking: "look at main.go", Signature: "enc-1", Data: "rs_1"},
+				NewTextBlock("Reading main.go."),
+				NewToolUseBlock("call_1", "read_file", json.RawMessage(`{"path":"main.go"}`)),
+			),
+			UserMessage(NewToolResultBlock("call_1", "package main", false), NewTextBlock("note")),
+		},
+		Reasoning: Reasoning{Effort: "high"},
+	})
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+	var body struct {
+		Instructions string           `json:"instructions"`
+		Store        bool             `json:"store"`
+		Include      []string         `json:"include"`
+		Reasoning    map[string]any   `json:"reasoning"`
+		Input        []map[string]any `json:"input"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatalf("unmarshal request: %v", err)
+	}
+
+	if body.Instructions != "system" || body.Store {
+		t.Errorf("instructions = %q, store = %v", body.Instructions, body.Store)
+	}
+	if len(body.Include) != 1 || body.Include[0] != "reasoning.encrypted_content" || body.Reasoning["effort"] != "high" {
+		t.Errorf("reasoning not requested: include %v, reasoning %v", body.Include, body.Reasoning)
+	}
+
+	wantTypes := []string{"message", "reasoning", "message", "function_call", "function_call_output", "message"}
+	if len(body.Input) != len(wantTypes) {
+		t.Fatalf("got %d input items, want %d: %s", len(body.Input), len(wantTypes), data)
+	}
+	for i, want := range wantTypes {
+		typ, _ := body.Input[i]["type"].(string)
+		if typ == "" {
+			typ = "message" // easy input messages may omit their type
+		}
+		if typ != want {
+			t.Errorf("item %d: type %q, want %q", i, typ, want)
+		}
+	}
+	if r := body.Input[1]; r["id"] != "rs_1" || r["encrypted_content"] != "enc-1" {
+		t.Errorf("reasoning item not passed through: %v", r)
+	}
+	if c := body.Input[3]; c["call_id"] != "call_1" || c["arguments"] != `{"path":"main.go"}` {
+		t.Errorf("function call = %v", c)
+	}
+}
+
+func TestResponsesOutputConversion(t *testing.T) {
+	var resp responses.Response
+	err := json.Unmarshal([]byte(`{
+		"status": "completed",
+		"output": [
+			{"type": "reasoning", "id": "rs_1", "encrypted_content": "enc-1", "summary": [{"type": "summary_text", "text": "thinking"}]},
+			{"type": "message", "role": "assistant", "content": [{"type": "output_text", "text": "Reading."}]},
+			{"type": "function_call", "id": "fc_1", "call_id": "call_1", "name": "read_file", "arguments": "{\"path\":\"a.go\"}"}
+		],
+		"usage": {"input_tokens": 100, "input_tokens_details": {"cached_tokens": 40}, "output_tokens": 20}
+	}`), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := convertResponsesOutput(&resp)
+	if got.StopReason != StopReasonToolUse {
+		t.Errorf("stop reason = %s", got.StopReason)
+	}
+	if len(got.Content) != 3 {
+		t.Fatalf("got %d blocks, want 3", len(got.Content))
+	}
+	if b := got.Content[0]; b.Type != "thinking" || b.Thinking != "thinking" || b.Signature != "enc-1" || b.Data != "rs_1" {
+		t.Errorf("reasoning block = %+v", b)
+	}
+	if b := got.Content[2]; b.ToolUseID != "call_1" || b.ToolName != "read_file" {
+		t.Errorf("tool block = %+v", b)
+	}
+	if got.Usage.InputTokens != 60 || got.Usage.CacheReadTokens != 40 || got.Usage.OutputTokens != 20 {
+		t.Errorf("usage = %+v", got.Usage)
+	}
+}
@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAIRequestMaxTokensField(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider Provider
+		want     string
+	}{
+		{"openai", NewOpenAI("key", ""), "max_completion_tokens"},
+		{"compatible", NewOpenAICompatible("http://localhost:8000/v1", "", "llama3", nil), "max_tokens"},
+		{"azure current", NewAzureOpenAI("https://example.openai.azure.com", "gpt-4o", "2024-10-21", "key"), "max_completion_tokens"},
+		{"azure old", NewAzureOpenAI("https://example.openai.azure.com", "gpt-4o", "2024-06-01", "key"), "max_tokens"},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.provider.(*openaiProvider).buildRequest(ChatParams{MaxTokens: 1000}))
+		if err != nil {
+			t.Fatalf("%s: marshal request: %v", tt.name, err)
+		}
+		var req map[string]any
+		if err := json.Unmarshal(data, &req); err != nil {
+			t.Fatalf("%s: unmarshal request: %v", tt.name, err)
+		}
+		other := "max_tokens"
+		if tt.want == other {
+			other = "max_completion_tokens"
+		}
+		if req[tt.want] != float64(1000) || req[other] != nil {
+			t.Errorf("%s: %s = %v, %s = %v; want only %s", tt.name, tt.want, req[tt.want], other, req[other], tt.want)
+		}
+	}
+}
+
+func TestOpenAIRequestSerialTools(t *testing.T) {
+	p := NewOpenAI("key", "").(*openaiProvider)
+	for _, serial := range []bool{false, true} {
+		data, err := json.Marshal(p.buildRequest(ChatParams{Tools: []Tool{{Name: "read_file"}}, SerialTools: serial}))
+		if err != nil {
+			t.Fatalf("marshal request: %v", err)
+		}
+		var req map[string]any
+		if err := json.Unmarshal(data, &req); err != nil {
+			t.Fatalf("unmarshal request: %v", err)
+		}
+		if parallel, set := req["parallel_tool_calls"]; set != serial || (serial && parallel != false) {
+			t.Errorf("serial %v: parallel_tool_calls = %v (set %v)", serial, parallel, set)
+		}
+	}
+}
+
+func TestAzureOpenAIRequestRouting(t *testing.T) {
+	var gotPath, gotVersion, gotKey string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotVersion, gotKey = r.URL.Path, r.URL.Query().Get("api-version"), r.Header.Get("Api-Key")
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, openaiCompletion)
+	}))
+	defer srv.Close()
+
+	p := NewAzureOpenAI(srv.URL, "my-deployment", "2024-10-21", "secret")
+	if _, err := p.Chat(context.Background(), ChatParams{Messages: []Message{UserMessage(NewTextBlock("hi"))}}); err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if gotPath != "/openai/deployments/my-deployment/chat/completions" || gotVersion != "2024-10-21" || gotKey != "secret" {
+		t.Errorf("request went to %s?api-version=%s with key %q", gotPath, gotVersion, gotKey)
+	}
+}
@@ -0,0 +1,55 @@
+package provider
+
+import "fmt"
+
+// Price is the cost of a model in USD per million tokens.
+type Price struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheRead  float64 `json:"cache_read"`
+	CacheWrite float64 `json:"cache_write"`
+}
+
+// Cost returns the USD cost of the given usage at this price.
+func (p Price) Cost(u Usage) float64 {
+	return (float64(u.InputTokens)*p.Input +
+		float64(u.OutputTokens)*p.Output +
+		float64(u.CacheReadTokens)*p.CacheRead +
+		float64(u.CacheWriteTokens)*p.CacheWrite) / 1_000_000
+}
+
+// PriceTable maps "provider/model" keys (e.g. "claude/claude-sonnet-4-5-20250929")
+// to prices. Provider names are canonical, see CanonicalName.
+type PriceTable map[string]Price
+
+// DefaultPrices covers the default model of each provider plus common alternatives.
+var DefaultPrices = PriceTable{
+	"claude/claude-sonnet-4-5-20250929":        {Input: 3, Output: 15, CacheRead: 0.30, CacheWrite: 3.75},
+	"claude/claude-haiku-4-5-20251001":         {Input: 1, Output: 5, CacheRead: 0.10, CacheWrite: 1.25},
+	"claude/claude-opus-4-1-20250805":          {Input: 15, Output: 75, CacheRead: 1.50, CacheWrite: 18.75},
+	"openai/gpt-4o":                            {Input: 2.50, Output: 10, CacheRead: 1.25},
+	"openai/gpt-4o-mini":                       {Input: 0.15, Output: 0.60, CacheRead: 0.075},
+	"openai-responses/gpt-4o":                  {Input: 2.50, Output: 10, CacheRead: 1.25},
+	"openai-responses/gpt-4o-mini":             {Input: 0.15, Output: 0.60, CacheRead: 0.075},
+	"gemini/gemini-2.5-flash":                  {Input: 0.30, Output: 2.50, CacheRead: 0.075},
+	"gemini/gemini-2.5-pro":                    {Input: 1.25, Output: 10, CacheRead: 0.31},
+	"vertex-claude/claude-sonnet-4-5@20250929": {Input: 3, Output: 15, CacheRead: 0.30, CacheWrite: 3.75},
+	"vertex-gemini/gemini-2.5-flash":           {Input: 0.30, Output: 2.50, CacheRead: 0.075},
+	"vertex-gemini/gemini-2.5-pro":             {Input: 1.25, Output: 10, CacheRead: 0.31},
+}
+
+// LookupPrice finds the price for a provider/model pair, consulting overrides
+// before DefaultPrices. An empty model resolves to the provider's default.
+func LookupPrice(overrides PriceTable, providerName, model string) (Price, bool) {
+	name := CanonicalName(providerName)
+	if model == "" {
+		model = DefaultModel(name)
+	}
+	key := fmt.Sprintf("%s/%s", name, model)
+
+	if p, ok := overrides[key]; ok {
+		return p, true
+	}
+	p, ok := DefaultPrices[key]
+	return p, ok
+}
@@ -11,14 +11,105 @@ type Provider interface {
 	// Chat sends a conversation to the LLM and returns its response.
 	// Supports system prompts, multi-turn messages, and tool use.
 	Chat(ctx context.Context, params ChatParams) (*ChatResponse, error)
+
+	// ChatStream behaves like Chat but reports text and tool-call deltas to
+	// onEvent as they arrive. The returned ChatResponse is assembled from the
+	// full stream and is equivalent to what Chat would have returned.
+	ChatStream(ctx context.Context, params ChatParams, onEvent StreamHandler) (*ChatResponse, error)
+
+	// CountTokens returns the number of input tokens params would use.
+	// Providers without a counting endpoint return EstimateTokens.
+	CountTokens(ctx context.Context, params ChatParams) (int, error)
 }
 
 // ChatParams holds the parameters for a chat request.
 type ChatParams struct {
-	System   string
-	Messages []Message
-	Tools    []Tool
-	MaxTokens int
+	System     string
+	Messages   []Message
+	Tools      []Tool
+	MaxTokens  int
+	Reasoning  Reasoning
+	ToolChoice ToolChoice
+
+	// SerialTools asks for at most one tool call per response, for models
+	// that cannot call tools in parallel. Gemini has no such setting and
+	// ignores it.
+	SerialTools bool
+}
+
+// ToolChoiceMode says whether the model may, must or must not call tools.
+type ToolChoiceMode string
+
+const (
+	ToolChoiceAuto ToolChoiceMode = "auto" // the model decides (the default)
+	ToolChoiceAny  ToolChoiceMode = "any"  // the model must call at least one tool
+	ToolChoiceNone ToolChoiceMode = "none" // the model must answer in text
+	ToolChoiceTool ToolChoiceMode = "tool" // the model must call the named tool
+)
+
+// ToolChoice constrains tool use for one request. The zero value is
+// equivalent to ToolChoiceAuto.
+type ToolChoice struct {
+	Mode ToolChoiceMode
+	Name string // tool to call when Mode is ToolChoiceTool
+}
+
+// ForceTool returns a ToolChoice that requires a call to the named tool.
+func ForceTool(name string) ToolChoice {
+	return ToolChoice{Mode: ToolChoiceTool, Name: name}
+}
+
+// forced reports whether the choice requires the model to call a tool.
+func (c ToolChoice) forced() bool {
+	return c.Mode == ToolChoiceAny || c.Mode == ToolChoiceTool
+}
+
+// Reasoning configures extended thinking for models that support it.
+// Providers use whichever setting they understand and derive the other:
+// Claude and Gemini take a token budget, OpenAI takes an effort level.
+type Reasoning struct {
+	BudgetTokens int    // tokens the model may spend thinking (0 = off unless Effort is set)
+	Effort       string // "low", "medium" or "high" ("" = off unless BudgetTokens is set)
+}
+
+// Enabled reports whether any reasoning setting is present.
+func (r Reasoning) Enabled() bool {
+	return r.BudgetTokens > 0 || r.Effort != ""
+}
+
+// Budget returns the thinking budget, derived from Effort when no explicit
+// budget is set.
+func (r Reasoning) Budget() int {
+	if r.BudgetTokens > 0 {
+		return r.BudgetTokens
+	}
+	switch r.Effort {
+	case "low":
+		return 2048
+	case "medium":
+		return 8192
+	case "high":
+		return 24576
+	default:
+		return 0
+	}
+}
+
+// EffortLevel returns the effort level, derived from BudgetTokens when no
+// explicit effort is set.
+func (r Reasoning) EffortLevel() string {
+	switch {
+	case r.Effort != "":
+		return r.Effort
+	case r.BudgetTokens == 0:
+		return ""
+	case r.BudgetTokens <= 4096:
+		return "low"
+	case r.BudgetTokens <= 16384:
+		return "medium"
+	default:
+		return "high"
+	}
 }
 
 // Role represents the role of a message sender.
@@ -37,55 +128,144 @@ type Message struct {
 
 // ContentBlock is a union type for message content.
 type ContentBlock struct {
-	Type string // "text", "tool_use", "tool_result"
+	Type string // "text", "image", "tool_use", "tool_result", "thinking", "redacted_thinking"
 
 	// For text blocks
 	Text string
 
+	// For image blocks
+	ImageData []byte
+	MediaType string // e.g. "image/png"
+
 	// For tool_use blocks
-	ToolUseID   string
-	ToolName    string
-	ToolInput   json.RawMessage
+	ToolUseID string
+	ToolName  string
+	ToolInput json.RawMessage
 
 	// For tool_result blocks
 	ToolResultID string
 	ToolResult   string
 	IsError      bool
+
+	// For thinking blocks. Signature (and Data, for redacted thinking) are
+	// opaque provider tokens that must be sent back unchanged. Gemini also
+	// attaches a Signature to tool_use blocks; the OpenAI Responses API keeps
+	// the reasoning item ID in Data.
+	Thinking  string
+	Signature string
+	Data      string
 }
 
 // Tool defines a tool the LLM can call.
 type Tool struct {
 	Name        string
 	Description string
-	Parameters  map[string]interface{} // JSON Schema properties
-	Required    []string
+	Parameters  *Schema // object schema of the tool input; nil for a tool without parameters
+	Strict      bool    // request exact schema adherence where supported (OpenAI strict mode)
+}
+
+// inputSchema returns the tool's parameter schema, or an empty object schema
+// if the tool takes no parameters.
+func (t Tool) inputSchema() *Schema {
+	if t.Parameters == nil {
+		return &Schema{Type: TypeObject}
+	}
+	return t.Parameters
 }
 
 // StopReason indicates why the LLM stopped generating.
 type StopReason string
 
 const (
-	StopReasonEndTurn StopReason = "end_turn"
-	StopReasonToolUse StopReason = "tool_use"
-	StopReasonMaxTokens StopReason = "max_tokens"
+	StopReasonEndTurn         StopReason = "end_turn"
+	StopReasonToolUse         StopReason = "tool_use"
+	StopReasonMaxTokens       StopReason = "max_tokens"
+	StopReasonContentFiltered StopReason = "content_filtered" // blocked by a safety, recitation or policy filter
+	StopReasonRefusal         StopReason = "refusal"          // the model declined to respond
+	StopReasonPauseTurn       StopReason = "pause_turn"       // the turn was paused; resend the conversation to continue
 )
 
 // ChatResponse holds the LLM's response.
 type ChatResponse struct {
 	Content    []ContentBlock
 	StopReason StopReason
+	Usage      Usage
+}
+
+// Usage reports the tokens consumed by a request. InputTokens excludes
+// tokens read from or written to the prompt cache, which are counted
+// separately because providers bill them at different rates.
+type Usage struct {
+	InputTokens      int
+	OutputTokens     int
+	CacheReadTokens  int
+	CacheWriteTokens int
+}
+
+// Add accumulates other into u.
+func (u *Usage) Add(other Usage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CacheReadTokens += other.CacheReadTokens
+	u.CacheWriteTokens += other.CacheWriteTokens
+}
+
+// String formats the usage for logs.
+func (u Usage) String() string {
+	return fmt.Sprintf("input=%d output=%d cache_read=%d cache_write=%d",
+		u.InputTokens, u.OutputTokens, u.CacheReadTokens, u.CacheWriteTokens)
 }
 
+// StreamEventType identifies the kind of incremental update in a stream.
+type StreamEventType string
+
+const (
+	StreamEventTextDelta     StreamEventType = "text_delta"
+	StreamEventThinkingDelta StreamEventType = "thinking_delta"
+	StreamEventToolUseStart  StreamEventType = "tool_use_start"
+	StreamEventToolUseDelta  StreamEventType = "tool_use_delta"
+)
+
+// StreamEvent is a single incremental update from a streaming chat request.
+type StreamEvent struct {
+	Type StreamEventType
+
+	// For text and thinking deltas
+	Text string
+
+	// For tool use events. InputDelta is a fragment of the JSON arguments;
+	// fragments are only valid JSON once concatenated.
+	ToolUseID  string
+	ToolName   string
+	InputDelta string
+}
+
+// StreamHandler receives stream events as they arrive. It is called from the
+// goroutine that invoked ChatStream.
+type StreamHandler func(StreamEvent)
+
 // Helper constructors
 
 func NewTextBlock(text string) ContentBlock {
 	return ContentBlock{Type: "text", Text: text}
 }
 
+func NewImageBlock(data []byte, mediaType string) ContentBlock {
+	return ContentBlock{Type: "image", ImageData: data, MediaType: mediaType}
+}
+
 func NewToolUseBlock(id, name string, input json.RawMessage) ContentBlock {
 	return ContentBlock{Type: "tool_use", ToolUseID: id, ToolName: name, ToolInput: input}
 }
 
+func NewThinkingBlock(thinking, signature string) ContentBlock {
+	return ContentBlock{Type: "thinking", Thinking: thinking, Signature: signature}
+}
+
+func NewRedactedThinkingBlock(data string) ContentBlock {
+	return ContentBlock{Type: "redacted_thinking", Data: data}
+}
+
 func NewToolResultBlock(toolUseID, result string, isError bool) ContentBlock {
 	return ContentBlock{Type: "tool_result", ToolResultID: toolUseID, ToolResult: result, IsError: isError}
 }
@@ -98,16 +278,121 @@ func AssistantMessage(content ...ContentBlock) Message {
 	return Message{Role: RoleAssistant, Content: content}
 }
 
-// NewProvider creates a provider instance based on the provider name.
-func NewProvider(name, apiKey, model string) (Provider, error) {
+// Config selects and configures a provider.
+type Config struct {
+	Name    string            `json:"provider"` // see NewProvider for supported names
+	APIKey  string            `json:"api_key"`
+	Model   string            `json:"model"`
+	BaseURL string            `json:"base_url"` // API endpoint for openai-compatible servers
+	Headers map[string]string `json:"headers"`  // extra HTTP headers sent with every request
+
+	// Vertex AI (vertex-claude, vertex-gemini)
+	Project         string `json:"project"`
+	Location        string `json:"location"`
+	CredentialsJSON string `json:"credentials_json"` // service-account key; empty uses Application Default Credentials
+
+	// Azure OpenAI (azure-openai): BaseURL is the resource endpoint and Model
+	// the deployment name.
+	APIVersion string `json:"api_version"`
+}
+
+// Default models used when Config.Model is empty.
+const (
+	DefaultClaudeModel = "claude-sonnet-4-5-20250929"
+	DefaultOpenAIModel = "gpt-4o"
+	DefaultGeminiModel = "gemini-2.5-flash"
+)
+
+// CanonicalName maps provider name aliases to their canonical form.
+func CanonicalName(name string) string {
 	switch name {
 	case "claude", "anthropic":
-		return NewClaude(apiKey, model), nil
+		return "claude"
+	case "openai", "gpt":
+		return "openai"
+	case "openai-responses", "responses":
+		return "openai-responses"
+	case "gemini", "google":
+		return "gemini"
+	case "openai-compatible", "local":
+		return "openai-compatible"
+	case "vertex-claude", "claude-vertex":
+		return "vertex-claude"
+	case "vertex-gemini", "gemini-vertex", "vertex":
+		return "vertex-gemini"
+	case "azure-openai", "azure":
+		return "azure-openai"
+	default:
+		return name
+	}
+}
+
+// DefaultModel returns the model a provider uses when none is configured,
+// or "" if the provider has no default.
+func DefaultModel(name string) string {
+	switch CanonicalName(name) {
+	case "claude":
+		return DefaultClaudeModel
+	case "openai", "openai-responses":
+		return DefaultOpenAIModel
+	case "gemini":
+		return DefaultGeminiModel
+	case "vertex-claude":
+		return DefaultVertexClaudeModel
+	case "vertex-gemini":
+		return DefaultVertexGeminiModel
+	default:
+		return ""
+	}
+}
+
+// NewProvider creates a provider instance based on the provider name.
+func NewProvider(cfg Config) (Provider, error) {
+	switch cfg.Name {
+	case "claude", "anthropic":
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("provider %q requires an API key", cfg.Name)
+		}
+		return NewClaude(cfg.APIKey, cfg.Model), nil
 	case "openai", "gpt":
-		return NewOpenAI(apiKey, model), nil
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("provider %q requires an API key", cfg.Name)
+		}
+		return NewOpenAI(cfg.APIKey, cfg.Model), nil
+	case "openai-responses", "responses":
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("provider %q requires an API key", cfg.Name)
+		}
+		return NewOpenAIResponses(cfg.APIKey, cfg.Model), nil
 	case "gemini", "google":
-		return NewGemini(apiKey, model), nil
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("provider %q requires an API key", cfg.Name)
+		}
+		return NewGemini(cfg.APIKey, cfg.Model), nil
+	case "openai-compatible", "local":
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("provider %q requires a base URL", cfg.Name)
+		}
+		if cfg.Model == "" {
+			return nil, fmt.Errorf("provider %q requires a model name", cfg.Name)
+		}
+		return NewOpenAICompatible(cfg.BaseURL, cfg.APIKey, cfg.Model, cfg.Headers), nil
+	case "vertex-claude", "claude-vertex":
+		if cfg.Project == "" || cfg.Location == "" {
+			return nil, fmt.Errorf("provider %q requires a project and location", cfg.Name)
+		}
+		return NewVertexClaude(cfg.Project, cfg.Location, cfg.CredentialsJSON, cfg.Model)
+	case "vertex-gemini", "gemini-vertex", "vertex":
+		if cfg.Project == "" || cfg.Location == "" {
+			return nil, fmt.Errorf("provider %q requires a project and location", cfg.Name)
+		}
+		return NewVertexGemini(cfg.Project, cfg.Location, cfg.CredentialsJSON, cfg.Model)
+	case "azure-openai", "azure":
+		if cfg.BaseURL == "" || cfg.Model == "" || cfg.APIVersion == "" || cfg.APIKey == "" {
+			return nil, fmt.Errorf("provider %q requires an endpoint (base URL), deployment (model), API version and API key", cfg.Name)
+		}
+		return NewAzureOpenAI(cfg.BaseURL, cfg.Model, cfg.APIVersion, cfg.APIKey), nil
 	default:
-		return nil, fmt.Errorf("unknown provider %q — supported: claude, openai, gemini", name)
+		return nil, fmt.Errorf("unknown provider %q — supported: claude, openai, openai-responses, gemini, openai-compatible, vertex-claude, vertex-gemini, azure-openai", cfg.Name)
 	}
 }
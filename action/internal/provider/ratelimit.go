@@ -0,0 +1,182 @@
+package provider
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig sets client-side request and token rates. Zero disables
+// the corresponding limit.
+type RateLimitConfig struct {
+	RequestsPerMinute int
+	TokensPerMinute   int
+}
+
+// RateLimiter throttles provider calls with a pair of token buckets, one for
+// requests and one for tokens. A single limiter can wrap several providers,
+// including ones used by concurrent agents, to keep their combined traffic
+// under an account's limits.
+type RateLimiter struct {
+	mu       sync.Mutex
+	requests bucket
+	tokens   bucket
+	now      func() time.Time
+}
+
+// NewRateLimiter creates a limiter whose buckets start full.
+func NewRateLimiter(cfg RateLimitConfig) *RateLimiter {
+	now := time.Now()
+	return &RateLimiter{
+		requests: newBucket(cfg.RequestsPerMinute, now),
+		tokens:   newBucket(cfg.TokensPerMinute, now),
+		now:      time.Now,
+	}
+}
+
+// Wrap returns a provider that waits for capacity before each call to inner.
+// The wait is based on an estimate of the request's input tokens; once the
+// call returns, the token bucket is corrected with the actual usage.
+func (l *RateLimiter) Wrap(inner Provider) Provider {
+	return &rateLimitedProvider{inner: inner, limiter: l}
+}
+
+// Wait blocks until a request of the given number of tokens may be sent, or
+// ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context, tokens int) error {
+	logged := false
+	for {
+		delay := l.reserve(tokens)
+		if delay == 0 {
+			return nil
+		}
+		if !logged {
+			log.Printf("Rate limit: waiting %s before sending request (~%d tokens)", delay.Round(time.Millisecond), tokens)
+			logged = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Reconcile charges (or refunds) the difference between the tokens a
+// request was estimated at and the tokens it actually used.
+func (l *RateLimiter) Reconcile(estimated, actual int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens.refill(l.now())
+	l.tokens.level -= float64(actual - estimated)
+	l.tokens.level = min(l.tokens.level, l.tokens.capacity)
+}
+
+// reserve takes one request and the given tokens from the buckets if both
+// have room, returning 0. Otherwise it takes nothing and returns how long to
+// wait before trying again.
+func (l *RateLimiter) reserve(tokens int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.requests.refill(now)
+	l.tokens.refill(now)
+
+	delay := max(l.requests.waitFor(1), l.tokens.waitFor(tokens))
+	if delay > 0 {
+		return delay
+	}
+	l.requests.take(1)
+	l.tokens.take(tokens)
+	return 0
+}
+
+// bucket is a token bucket holding up to one minute's allowance and
+// refilling continuously. A zero capacity means unlimited.
+type bucket struct {
+	capacity float64
+	level    float64
+	perSec   float64
+	updated  time.Time
+}
+
+func newBucket(perMinute int, now time.Time) bucket {
+	c := float64(perMinute)
+	return bucket{capacity: c, level: c, perSec: c / 60, updated: now}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if b.capacity == 0 {
+		return
+	}
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.level = min(b.capacity, b.level+elapsed*b.perSec)
+	}
+	b.updated = now
+}
+
+// waitFor returns how long until n units are available. Requests larger
+// than the whole bucket only wait for it to be full, so they are not
+// blocked forever.
+func (b *bucket) waitFor(n int) time.Duration {
+	if b.capacity == 0 {
+		return 0
+	}
+	need := min(float64(n), b.capacity)
+	if b.level >= need {
+		return 0
+	}
+	return time.Duration((need - b.level) / b.perSec * float64(time.Second))
+}
+
+func (b *bucket) take(n int) {
+	if b.capacity == 0 {
+		return
+	}
+	b.level -= float64(n)
+}
+
+type rateLimitedProvider struct {
+	inner   Provider
+	limiter *RateLimiter
+}
+
+func (r *rateLimitedProvider) Chat(ctx context.Context, params ChatParams) (*ChatResponse, error) {
+	return r.do(ctx, params, func() (*ChatResponse, error) {
+		return r.inner.Chat(ctx, params)
+	})
+}
+
+func (r *rateLimitedProvider) ChatStream(ctx context.Context, params ChatParams, onEvent StreamHandler) (*ChatResponse, error) {
+	return r.do(ctx, params, func() (*ChatResponse, error) {
+		return r.inner.ChatStream(ctx, params, onEvent)
+	})
+}
+
+// CountTokens is not throttled: counting endpoints have their own limits
+// and do not consume the account's generation quota.
+func (r *rateLimitedProvider) CountTokens(ctx context.Context, params ChatParams) (int, error) {
+	return r.inner.CountTokens(ctx, params)
+}
+
+func (r *rateLimitedProvider) do(ctx context.Context, params ChatParams, call func() (*ChatResponse, error)) (*ChatResponse, error) {
+	estimated := EstimateTokens(params)
+	if err := r.limiter.Wait(ctx, estimated); err != nil {
+		return nil, err
+	}
+
+	resp, err := call()
+	if err != nil {
+		// A failed request may still have been counted upstream; keep the
+		// estimate charged rather than guessing.
+		return nil, err
+	}
+	u := resp.Usage
+	if actual := u.InputTokens + u.CacheReadTokens + u.CacheWriteTokens + u.OutputTokens; actual > 0 {
+		r.limiter.Reconcile(estimated, actual)
+	}
+	return resp, nil
+}
@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewRateLimiter(RateLimitConfig{RequestsPerMinute: 2, TokensPerMinute: 6000})
+	l.now = func() time.Time { return now }
+	l.requests.updated, l.tokens.updated = now, now
+
+	if d := l.reserve(4000); d != 0 {
+		t.Fatalf("first request waited %s, want 0", d)
+	}
+	// 2000 tokens left; 3000 more accrue at 100/s in 10s.
+	if d := l.reserve(3000); d != 10*time.Second {
+		t.Fatalf("second request wait = %s, want 10s", d)
+	}
+
+	now = now.Add(10 * time.Second)
+	if d := l.reserve(3000); d != 0 {
+		t.Fatalf("after refill waited %s, want 0", d)
+	}
+	// Two requests taken, a third of one accrued over 10s; the rest of a
+	// request takes another 20s at one per 30s.
+	if d := l.reserve(1); d != 20*time.Second {
+		t.Fatalf("third request wait = %s, want 20s", d)
+	}
+}
+
+func TestRateLimiterReconcile(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewRateLimiter(RateLimitConfig{TokensPerMinute: 6000})
+	l.now = func() time.Time { return now }
+	l.tokens.updated = now
+
+	if d := l.reserve(1000); d != 0 {
+		t.Fatalf("reserve waited %s, want 0", d)
+	}
+	// The request really cost 4000 tokens, leaving 2000.
+	l.Reconcile(1000, 4000)
+	if d := l.reserve(3000); d != 10*time.Second {
+		t.Fatalf("wait after reconcile = %s, want 10s", d)
+	}
+
+	// Over-estimates are refunded, but never beyond a full bucket.
+	l.Reconcile(100_000, 0)
+	if l.tokens.level != l.tokens.capacity {
+		t.Fatalf("level = %v, want capacity %v", l.tokens.level, l.tokens.capacity)
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	l := NewRateLimiter(RateLimitConfig{})
+	for i := 0; i < 100; i++ {
+		if d := l.reserve(1_000_000); d != 0 {
+			t.Fatalf("unlimited limiter waited %s", d)
+		}
+	}
+}
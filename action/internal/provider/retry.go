@@ -0,0 +1,228 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/openai/openai-go"
+	"google.golang.org/genai"
+)
+
+// DefaultMaxRetries is the number of retries used when RetryConfig.MaxRetries
+// is negative.
+const DefaultMaxRetries = 5
+
+// RetryConfig controls how transient provider errors are retried.
+// Zero durations fall back to sensible defaults.
+type RetryConfig struct {
+	MaxRetries int           // retries per request after the first attempt (0 = none, negative = DefaultMaxRetries)
+	BaseDelay  time.Duration // backoff before the first retry (default 2s)
+	MaxDelay   time.Duration // cap on a single backoff (default 60s)
+	MaxWait    time.Duration // total time a request may spend waiting between retries (default 5m)
+}
+
+type retryProvider struct {
+	inner  Provider
+	config RetryConfig
+}
+
+// WithRetry wraps a provider so that transient failures (rate limits,
+// overloads, server errors, dropped connections) are retried with jittered
+// exponential backoff, honoring any Retry-After hint from the server.
+// The provider constructors disable the SDKs' own retries, so this is the
+// only retry layer.
+func WithRetry(p Provider, cfg RetryConfig) Provider {
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = DefaultMaxRetries
+	}
+	if cfg.BaseDelay == 0 {
+		cfg.BaseDelay = 2 * time.Second
+	}
+	if cfg.MaxDelay == 0 {
+		cfg.MaxDelay = 60 * time.Second
+	}
+	if cfg.MaxWait == 0 {
+		cfg.MaxWait = 5 * time.Minute
+	}
+	return &retryProvider{inner: p, config: cfg}
+}
+
+func (r *retryProvider) Chat(ctx context.Context, params ChatParams) (*ChatResponse, error) {
+	return r.do(ctx, func() (*ChatResponse, error) {
+		return r.inner.Chat(ctx, params)
+	}, nil)
+}
+
+// ChatStream retries only failures that happen before the first event:
+// once deltas have reached onEvent, a retry would deliver them again.
+func (r *retryProvider) ChatStream(ctx context.Context, params ChatParams, onEvent StreamHandler) (*ChatResponse, error) {
+	streamed := false
+	handler := func(ev StreamEvent) {
+		streamed = true
+		onEvent(ev)
+	}
+	return r.do(ctx, func() (*ChatResponse, error) {
+		return r.inner.ChatStream(ctx, params, handler)
+	}, func() bool { return !streamed })
+}
+
+func (r *retryProvider) CountTokens(ctx context.Context, params ChatParams) (int, error) {
+	var n int
+	_, err := r.do(ctx, func() (*ChatResponse, error) {
+		var err error
+		n, err = r.inner.CountTokens(ctx, params)
+		return nil, err
+	}, nil)
+	return n, err
+}
+
+// do runs call, retrying transient failures. canRetry, if non-nil, is
+// consulted after each failure and vetoes further attempts.
+func (r *retryProvider) do(ctx context.Context, call func() (*ChatResponse, error), canRetry func() bool) (*ChatResponse, error) {
+	var waited time.Duration
+	for attempt := 0; ; attempt++ {
+		resp, err := call()
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		retryable, retryAfter := classifyError(err)
+		if !retryable || attempt >= r.config.MaxRetries {
+			return nil, err
+		}
+		if canRetry != nil && !canRetry() {
+			log.Printf("Transient provider error after the response started streaming, not retrying: %v", err)
+			return nil, err
+		}
+
+		delay := r.backoff(attempt)
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		if waited+delay > r.config.MaxWait {
+			return nil, fmt.Errorf("retry budget of %s exhausted after %d attempts: %w", r.config.MaxWait, attempt+1, err)
+		}
+
+		log.Printf("Transient provider error (attempt %d/%d), retrying in %s: %v", attempt+1, r.config.MaxRetries+1, delay.Round(time.Millisecond), err)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		waited += delay
+	}
+}
+
+// backoff returns the jittered exponential delay before the given retry,
+// drawn uniformly from the upper half of the exponential window.
+func (r *retryProvider) backoff(attempt int) time.Duration {
+	delay := r.config.BaseDelay << attempt
+	if delay <= 0 || delay > r.config.MaxDelay {
+		delay = r.config.MaxDelay
+	}
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// classifyError reports whether err is worth retrying and, if the server
+// said how long to wait, the requested delay.
+func classifyError(err error) (retryable bool, retryAfter time.Duration) {
+	var claudeErr *anthropic.Error
+	if errors.As(err, &claudeErr) {
+		return isRetryableStatus(claudeErr.StatusCode), retryAfterFromResponse(claudeErr.Response)
+	}
+
+	var openaiErr *openai.Error
+	if errors.As(err, &openaiErr) {
+		// An exhausted quota also comes back as a 429, but waiting will not
+		// refill it.
+		if classifyCode(openaiErr.Code) == ErrQuotaExceeded {
+			return false, 0
+		}
+		return isRetryableStatus(openaiErr.StatusCode), retryAfterFromResponse(openaiErr.Response)
+	}
+
+	var geminiErr genai.APIError
+	if errors.As(err, &geminiErr) {
+		return isRetryableStatus(geminiErr.Code), retryAfterFromDetails(geminiErr.Details)
+	}
+
+	// Errors reported in-band, as a stream event, carry only a code.
+	kind := classifyCode(streamErrorCode(err))
+	var apiErr *APIError
+	if kind == nil && errors.As(err, &apiErr) {
+		kind = apiErr.Kind
+	}
+	if kind != nil {
+		return kind == ErrRateLimited || kind == ErrServer, 0
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true, 0
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+		return true, 0
+	}
+	return false, 0
+}
+
+// isRetryableStatus reports whether an HTTP status indicates a transient failure.
+// 529 is Anthropic's "overloaded" status.
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return true
+	}
+	return code >= 500
+}
+
+// retryAfterFromResponse reads the Retry-After (or retry-after-ms) header.
+func retryAfterFromResponse(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	if ms, err := strconv.ParseFloat(resp.Header.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// retryAfterFromDetails reads the retryDelay of a google.rpc.RetryInfo error detail.
+func retryAfterFromDetails(details []map[string]any) time.Duration {
+	for _, d := range details {
+		if d["@type"] != "type.googleapis.com/google.rpc.RetryInfo" {
+			continue
+		}
+		delay, _ := d["retryDelay"].(string)
+		if parsed, err := time.ParseDuration(delay); err == nil {
+			return parsed
+		}
+	}
+	return 0
+}
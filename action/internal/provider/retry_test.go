@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// flakyProvider fails with a connection error until fails reaches zero,
+// streaming partial text first if partial is set.
+type flakyProvider struct {
+	fails   int
+	partial bool
+	calls   int
+}
+
+func (f *flakyProvider) Chat(ctx context.Context, params ChatParams) (*ChatResponse, error) {
+	return f.ChatStream(ctx, params, func(StreamEvent) {})
+}
+
+func (f *flakyProvider) ChatStream(ctx context.Context, params ChatParams, onEvent StreamHandler) (*ChatResponse, error) {
+	f.calls++
+	if f.partial {
+		onEvent(StreamEvent{Type: StreamEventTextDelta, Text: "partial "})
+	}
+	if f.fails > 0 {
+		f.fails--
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset")}
+	}
+	return &ChatResponse{Content: []ContentBlock{NewTextBlock("done")}, StopReason: StopReasonEndTurn}, nil
+}
+
+func (f *flakyProvider) CountTokens(ctx context.Context, params ChatParams) (int, error) {
+	return EstimateTokens(params), nil
+}
+
+func TestRetryAttempts(t *testing.T) {
+	tests := []struct {
+		maxRetries int
+		fails      int
+		wantCalls  int
+		wantErr    bool
+	}{
+		{maxRetries: 0, fails: 1, wantCalls: 1, wantErr: true},
+		{maxRetries: 2, fails: 1, wantCalls: 2},
+		{maxRetries: 2, fails: 5, wantCalls: 3, wantErr: true},
+		{maxRetries: -1, fails: DefaultMaxRetries, wantCalls: DefaultMaxRetries + 1},
+	}
+	for _, tt := range tests {
+		inner := &flakyProvider{fails: tt.fails}
+		p := WithRetry(inner, RetryConfig{MaxRetries: tt.maxRetries, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+
+		_, err := p.Chat(context.Background(), ChatParams{})
+		if (err != nil) != tt.wantErr || inner.calls != tt.wantCalls {
+			t.Errorf("MaxRetries %d, %d failures: %d calls, err %v; want %d calls, error %v",
+				tt.maxRetries, tt.fails, inner.calls, err, tt.wantCalls, tt.wantErr)
+		}
+	}
+}
+
+func TestClassifyStreamErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"claude overloaded", fmt.Errorf("%s%s", streamErrorPrefix, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`), true},
+		{"claude rate limit", fmt.Errorf("%s%s", streamErrorPrefix, `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`), true},
+		{"claude api error", fmt.Errorf("%s%s", streamErrorPrefix, `{"type":"error","error":{"type":"api_error","message":"oops"}}`), true},
+		{"claude invalid request", fmt.Errorf("%s%s", streamErrorPrefix, `{"type":"error","error":{"type":"invalid_request_error","message":"bad"}}`), false},
+		{"openai server error", fmt.Errorf("%s%s", streamErrorPrefix, `{"message":"oops","type":"server_error","code":null}`), true},
+		{"responses event", newAPIError("openai", "rate_limit_exceeded", "slow down"), true},
+		{"responses failure", newAPIError("openai", "invalid_prompt", "bad"), false},
+		{"openai quota", &openai.Error{StatusCode: 429, Code: "insufficient_quota"}, false},
+	}
+	for _, tt := range tests {
+		if got, _ := classifyError(tt.err); got != tt.want {
+			t.Errorf("%s: retryable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryStopsOnceStreamStarted(t *testing.T) {
+	inner := &flakyProvider{fails: 1, partial: true}
+	p := WithRetry(inner, RetryConfig{MaxRetries: 3, BaseDelay: time.Millisecond})
+
+	var deltas int
+	_, err := p.ChatStream(context.Background(), ChatParams{}, func(StreamEvent) { deltas++ })
+	if err == nil {
+		t.Fatal("expected the mid-stream failure to be returned")
+	}
+	if inner.calls != 1 || deltas != 1 {
+		t.Errorf("got %d calls and %d deltas, want the stream not to be retried", inner.calls, deltas)
+	}
+}
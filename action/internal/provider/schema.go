@@ -0,0 +1,77 @@
+package provider
+
+import "sort"
+
+// Schema type names, following JSON Schema.
+const (
+	TypeObject  = "object"
+	TypeArray   = "array"
+	TypeString  = "string"
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+)
+
+// Schema is the provider-neutral subset of JSON Schema used to declare tool
+// parameters. Each provider translates it into its own format.
+type Schema struct {
+	Type        string             `json:"type"`
+	Description string             `json:"description,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Default     any                `json:"default,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`      // element schema for arrays
+	Properties  map[string]*Schema `json:"properties,omitempty"` // field schemas for objects
+	Required    []string           `json:"required,omitempty"`   // required fields for objects
+}
+
+// JSONSchema returns the schema as a standard JSON Schema document.
+func (s *Schema) JSONSchema() map[string]any {
+	out := map[string]any{"type": s.Type}
+	if s.Description != "" {
+		out["description"] = s.Description
+	}
+	if len(s.Enum) > 0 {
+		out["enum"] = s.Enum
+	}
+	if s.Default != nil {
+		out["default"] = s.Default
+	}
+	if s.Items != nil {
+		out["items"] = s.Items.JSONSchema()
+	}
+	if s.Type == TypeObject {
+		out["properties"] = s.propertiesJSONSchema()
+		if len(s.Required) > 0 {
+			out["required"] = s.Required
+		}
+	}
+	return out
+}
+
+// propertiesJSONSchema returns the JSON Schema of each object property.
+func (s *Schema) propertiesJSONSchema() map[string]any {
+	props := make(map[string]any, len(s.Properties))
+	for name, prop := range s.Properties {
+		props[name] = prop.JSONSchema()
+	}
+	return props
+}
+
+// propertyNames returns the object's property names in a stable order.
+func (s *Schema) propertyNames() []string {
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Schema) isRequired(name string) bool {
+	for _, r := range s.Required {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package provider
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+// batchEditSchema exercises arrays of objects, enums and defaults.
+var batchEditSchema = &Schema{
+	Type: TypeObject,
+	Properties: map[string]*Schema{
+		"edits": {
+			Type: TypeArray,
+			Items: &Schema{
+				Type: TypeObject,
+				Properties: map[string]*Schema{
+					"path": {Type: TypeString},
+					"mode": {Type: TypeString, Enum: []string{"replace", "append"}, Default: "replace"},
+				},
+				Required: []string{"path"},
+			},
+		},
+		"dry_run": {Type: TypeBoolean, Default: false},
+	},
+	Required: []string{"edits"},
+}
+
+// roundTrip encodes v as JSON and decodes it into generic values.
+func roundTrip(t *testing.T, v any) any {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestSchemaJSONSchema(t *testing.T) {
+	got := roundTrip(t, batchEditSchema.JSONSchema())
+	want := roundTrip(t, map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"edits": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"path": map[string]any{"type": "string"},
+						"mode": map[string]any{"type": "string", "enum": []string{"replace", "append"}, "default": "replace"},
+					},
+					"required": []string{"path"},
+				},
+			},
+			"dry_run": map[string]any{"type": "boolean", "default": false},
+		},
+		"required": []string{"edits"},
+	})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JSONSchema() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestStrictJSONSchema(t *testing.T) {
+	got := roundTrip(t, strictJSONSchema(batchEditSchema, true))
+	want := roundTrip(t, map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"edits": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"path": map[string]any{"type": "string"},
+						"mode": map[string]any{"type": []string{"string", "null"}, "enum": []any{"replace", "append", nil}},
+					},
+					"required":             []string{"mode", "path"},
+					"additionalProperties": false,
+				},
+			},
+			"dry_run": map[string]any{"type": []string{"boolean", "null"}},
+		},
+		"required":             []string{"dry_run", "edits"},
+		"additionalProperties": false,
+	})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("strictJSONSchema() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestConvertToGeminiSchema(t *testing.T) {
+	got := convertToGeminiSchema(batchEditSchema)
+	if got.Type != genai.TypeObject || !reflect.DeepEqual(got.Required, []string{"edits"}) {
+		t.Errorf("top level = %+v", got)
+	}
+	if !reflect.DeepEqual(got.PropertyOrdering, []string{"dry_run", "edits"}) {
+		t.Errorf("property ordering = %v", got.PropertyOrdering)
+	}
+	items := got.Properties["edits"].Items
+	if got.Properties["edits"].Type != genai.TypeArray || items == nil || items.Type != genai.TypeObject {
+		t.Fatalf("edits = %+v", got.Properties["edits"])
+	}
+	mode := items.Properties["mode"]
+	if mode.Type != genai.TypeString || !reflect.DeepEqual(mode.Enum, []string{"replace", "append"}) || mode.Default != "replace" {
+		t.Errorf("mode = %+v", mode)
+	}
+}
+
+func TestToolWithoutParameters(t *testing.T) {
+	tool := Tool{Name: "list_changes"}
+	got := roundTrip(t, tool.inputSchema().JSONSchema())
+	want := roundTrip(t, map[string]any{"type": "object", "properties": map[string]any{}})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JSONSchema() = %v, want %v", got, want)
+	}
+	if strict := strictJSONSchema(tool.inputSchema(), true); strict["additionalProperties"] != false {
+		t.Errorf("strict schema = %v, want additionalProperties false", strict)
+	}
+}
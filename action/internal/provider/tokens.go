@@ -0,0 +1,37 @@
+package provider
+
+import "encoding/json"
+
+// charsPerToken is the rough ratio of characters to tokens for English text
+// and source code across the supported tokenizers.
+const charsPerToken = 4
+
+// imageTokens approximates what one attached image costs; vendors charge
+// between roughly 250 and 1,600 tokens depending on its size.
+const imageTokens = 1600
+
+// EstimateTokens approximates the input tokens params will cost without
+// calling any API. It errs on the high side so it is safe for throttling.
+func EstimateTokens(params ChatParams) int {
+	chars := len(params.System)
+	images := 0
+	for _, msg := range params.Messages {
+		for _, block := range msg.Content {
+			switch block.Type {
+			case "image":
+				images++
+			default:
+				chars += len(block.Text) + len(block.Thinking) + len(block.ToolName) +
+					len(block.ToolInput) + len(block.ToolResult)
+			}
+		}
+	}
+	for _, tool := range params.Tools {
+		chars += len(tool.Name) + len(tool.Description)
+		if tool.Parameters != nil {
+			schema, _ := json.Marshal(tool.Parameters.JSONSchema())
+			chars += len(schema)
+		}
+	}
+	return (chars+charsPerToken-1)/charsPerToken + images*imageTokens
+}
@@ -0,0 +1,25 @@
+package provider
+
+import "testing"
+
+func TestEstimateTokens(t *testing.T) {
+	base := ChatParams{
+		System:   "12345678",                                       // 8 chars
+		Messages: []Message{UserMessage(NewTextBlock("abcdefgh"))}, // 8 chars
+	}
+	if got := EstimateTokens(base); got != 4 {
+		t.Errorf("text only: got %d, want 4", got)
+	}
+
+	withImage := base
+	withImage.Messages = append(withImage.Messages, UserMessage(NewImageBlock([]byte("png"), "image/png")))
+	if got := EstimateTokens(withImage); got != 4+imageTokens {
+		t.Errorf("with image: got %d, want %d", got, 4+imageTokens)
+	}
+
+	withTools := base
+	withTools.Tools = []Tool{{Name: "read_file", Description: "Read a file", Parameters: &Schema{Type: TypeObject}}}
+	if got := EstimateTokens(withTools); got <= 4 {
+		t.Errorf("tool definitions not counted: got %d", got)
+	}
+}
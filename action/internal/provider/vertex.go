@@ -0,0 +1,77 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/auth/credentials"
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/anthropics/anthropic-sdk-go/vertex"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/genai"
+)
+
+// cloudPlatformScope is the OAuth scope Vertex AI requests need.
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// Default models used on Vertex AI when Config.Model is empty.
+const (
+	DefaultVertexClaudeModel = "claude-sonnet-4-5@20250929"
+	DefaultVertexGeminiModel = DefaultGeminiModel
+)
+
+// NewVertexClaude creates a provider for Claude models served through Vertex AI.
+// credentialsJSON is a service-account key; if empty, Application Default
+// Credentials are used.
+func NewVertexClaude(project, location, credentialsJSON, model string) (Provider, error) {
+	if model == "" {
+		model = DefaultVertexClaudeModel
+	}
+
+	ctx := context.Background()
+	var creds *google.Credentials
+	var err error
+	if credentialsJSON != "" {
+		creds, err = google.CredentialsFromJSON(ctx, []byte(credentialsJSON), cloudPlatformScope)
+	} else {
+		creds, err = google.FindDefaultCredentials(ctx, cloudPlatformScope)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Google credentials: %w", err)
+	}
+
+	client := anthropic.NewClient(vertex.WithCredentials(ctx, location, project, creds), option.WithMaxRetries(0))
+	return &claudeProvider{client: &client, model: model}, nil
+}
+
+// NewVertexGemini creates a provider for Gemini models served through Vertex AI.
+// credentialsJSON is a service-account key; if empty, Application Default
+// Credentials are used.
+func NewVertexGemini(project, location, credentialsJSON, model string) (Provider, error) {
+	if model == "" {
+		model = DefaultVertexGeminiModel
+	}
+
+	cfg := &genai.ClientConfig{
+		Backend:  genai.BackendVertexAI,
+		Project:  project,
+		Location: location,
+	}
+	if credentialsJSON != "" {
+		creds, err := credentials.DetectDefault(&credentials.DetectOptions{
+			Scopes:          []string{cloudPlatformScope},
+			CredentialsJSON: []byte(credentialsJSON),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Google credentials: %w", err)
+		}
+		cfg.Credentials = creds
+	}
+
+	client, err := genai.NewClient(context.Background(), cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Vertex AI client: %w", err)
+	}
+	return &geminiProvider{client: client, model: model}, nil
+}
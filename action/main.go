@@ -2,28 +2,67 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/AkshayNayak/ticketflow/action/internal/agent"
+	"github.com/AkshayNayak/ticketflow/action/internal/provider"
 )
 
 func main() {
 	cfg := agent.Config{
 		Provider:          getInput("PROVIDER", "claude"),
-		APIKey:            requireInput("API_KEY"),
+		APIKey:            getInput("API_KEY", ""),
 		Model:             getInput("MODEL", ""),
+		BaseURL:           getInput("BASE_URL", ""),
+		Headers:           parseHeaders(getInput("HEADERS", "")),
+		Project:           getInput("VERTEX_PROJECT", ""),
+		Location:          getInput("VERTEX_LOCATION", ""),
+		CredentialsJSON:   getInput("GOOGLE_CREDENTIALS", ""),
+		APIVersion:        getInput("AZURE_API_VERSION", ""),
 		TicketKey:         requireInput("TICKET_KEY"),
 		TicketTitle:       requireInput("TICKET_TITLE"),
 		TicketDescription: requireInput("TICKET_DESCRIPTION"),
 		Workspace:         getEnv("GITHUB_WORKSPACE", "."),
+		Images:            splitList(getInput("IMAGES", "")),
+		MaxTokens:         getIntInput("MAX_TOKENS", 0),
+		MaxRetries:        getIntInput("MAX_RETRIES", provider.DefaultMaxRetries),
+		RateLimit: provider.RateLimitConfig{
+			RequestsPerMinute: getIntInput("RATE_LIMIT_RPM", 0),
+			TokensPerMinute:   getIntInput("RATE_LIMIT_TPM", 0),
+		},
+		BudgetUSD:    getFloatInput("BUDGET_USD", 0),
+		BudgetTokens: getIntInput("BUDGET_TOKENS", 0),
+		Pricing:      parsePricing(getInput("PRICING", "")),
+		Models:       parseModels(getInput("MODELS", "")),
+		CompactAt:    getFloatInput("COMPACT_AT", 0),
+		RecordPath:   getInput("RECORD_CASSETTE", ""),
+		Reasoning: provider.Reasoning{
+			Effort:       getInput("REASONING_EFFORT", ""),
+			BudgetTokens: getIntInput("THINKING_BUDGET", 0),
+		},
+		Fallbacks: parseFallbacks(getInput("FALLBACKS", "")),
 	}
 
 	log.Printf("Sprint Code Agent starting...")
 	log.Printf("Ticket: %s - %s", cfg.TicketKey, cfg.TicketTitle)
 	log.Printf("Provider: %s | Model: %s", cfg.Provider, cfg.Model)
+	if cfg.BaseURL != "" {
+		log.Printf("Base URL: %s", cfg.BaseURL)
+	}
+	if cfg.Project != "" {
+		log.Printf("Vertex AI: project %s, location %s", cfg.Project, cfg.Location)
+	}
+	if cfg.Reasoning.Enabled() {
+		log.Printf("Reasoning: effort=%s budget=%d", cfg.Reasoning.EffortLevel(), cfg.Reasoning.Budget())
+	}
+	for i, fb := range cfg.Fallbacks {
+		log.Printf("Fallback %d: %s | Model: %s", i+1, fb.Name, fb.Model)
+	}
 	log.Printf("Workspace: %s", cfg.Workspace)
 
 	a, err := agent.New(cfg)
@@ -32,17 +71,31 @@ func main() {
 	}
 
 	result, err := a.Run(context.Background())
+	reportResult(result)
 	if err != nil {
-		log.Fatalf("Agent failed: %v", err)
+		log.Fatalf("Agent failed (%s): %v", result.Status, err)
 	}
+}
 
-	log.Printf("Agent completed successfully!")
+// reportResult logs the outcome of a run and writes it as action outputs.
+func reportResult(result *agent.Result) {
+	log.Printf("Agent finished with status: %s", result.Status)
 	log.Printf("Files changed: %s", strings.Join(result.FilesChanged, ", "))
 	log.Printf("Summary: %s", result.Summary)
+	log.Printf("Tokens: %s", result.Usage)
+	log.Printf("Estimated cost: $%.4f", result.CostUSD)
+	log.Printf("Providers used: %s", strings.Join(result.Providers, ", "))
 
 	// Write outputs for GitHub Actions
+	writeOutput("status", string(result.Status))
 	writeOutput("files_changed", strings.Join(result.FilesChanged, ","))
 	writeOutput("summary", result.Summary)
+	writeOutput("input_tokens", strconv.Itoa(result.Usage.InputTokens))
+	writeOutput("output_tokens", strconv.Itoa(result.Usage.OutputTokens))
+	writeOutput("cache_read_tokens", strconv.Itoa(result.Usage.CacheReadTokens))
+	writeOutput("cache_write_tokens", strconv.Itoa(result.Usage.CacheWriteTokens))
+	writeOutput("cost_usd", strconv.FormatFloat(result.CostUSD, 'f', 4, 64))
+	writeOutput("providers_used", strings.Join(result.Providers, ","))
 }
 
 // requireInput reads a GitHub Actions input (INPUT_ env var) and exits if not set.
@@ -63,6 +116,32 @@ func getInput(name, defaultVal string) string {
 	return val
 }
 
+// getIntInput reads a numeric GitHub Actions input with a default fallback.
+func getIntInput(name string, defaultVal int) int {
+	val := getInput(name, "")
+	if val == "" {
+		return defaultVal
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		log.Fatalf("Input %s must be an integer, got %q", name, val)
+	}
+	return n
+}
+
+// getFloatInput reads a decimal GitHub Actions input with a default fallback.
+func getFloatInput(name string, defaultVal float64) float64 {
+	val := getInput(name, "")
+	if val == "" {
+		return defaultVal
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		log.Fatalf("Input %s must be a number, got %q", name, val)
+	}
+	return f
+}
+
 // getEnv reads an environment variable with a default fallback.
 func getEnv(name, defaultVal string) string {
 	val := os.Getenv(name)
@@ -72,6 +151,70 @@ func getEnv(name, defaultVal string) string {
 	return val
 }
 
+// splitList splits a comma- or newline-separated input into trimmed, non-empty items.
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseHeaders parses newline-separated "Name: Value" pairs into a header map.
+func parseHeaders(raw string) map[string]string {
+	headers := make(map[string]string)
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			log.Fatalf("Invalid header %q — expected \"Name: Value\"", line)
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return headers
+}
+
+// parsePricing parses a JSON object of "provider/model" keys to per-million-token prices.
+func parsePricing(raw string) provider.PriceTable {
+	if raw == "" {
+		return nil
+	}
+	var table provider.PriceTable
+	if err := json.Unmarshal([]byte(raw), &table); err != nil {
+		log.Fatalf("Invalid pricing input: %v", err)
+	}
+	return table
+}
+
+// parseModels parses a JSON object of model-name prefixes to model capabilities.
+func parseModels(raw string) provider.ModelTable {
+	if raw == "" {
+		return nil
+	}
+	var table provider.ModelTable
+	if err := json.Unmarshal([]byte(raw), &table); err != nil {
+		log.Fatalf("Invalid models input: %v", err)
+	}
+	return table
+}
+
+// parseFallbacks parses a JSON array of fallback provider entries.
+func parseFallbacks(raw string) []provider.Config {
+	if raw == "" {
+		return nil
+	}
+	var fallbacks []provider.Config
+	if err := json.Unmarshal([]byte(raw), &fallbacks); err != nil {
+		log.Fatalf("Invalid fallbacks input: %v", err)
+	}
+	return fallbacks
+}
+
 // writeOutput writes a value to the GitHub Actions output file.
 func writeOutput(name, value string) {
 	outputFile := os.Getenv("GITHUB_OUTPUT")